@@ -36,21 +36,18 @@ var (
 	port                        = flag.Uint("port", 8080, "The port to listen on.  Default 8080.")
 	address                     = flag.String("address", "127.0.0.1", "The address on the local server to listen to. Default 127.0.0.1")
 	apiPrefix                   = flag.String("api_prefix", "/api/v1beta1", "The prefix for API requests on the server. Default '/api/v1beta1'")
+	kubeletPort                 = flag.Uint("kubelet_port", 10250, "The port the kubelets serve container info on. Default 10250")
 	etcdServerList, machineList util.StringList
 )
 
 func init() {
 	flag.Var(&etcdServerList, "etcd_servers", "Servers for the etcd (http://ip:port), comma separated")
-	flag.Var(&machineList, "machines", "List of machines to schedule onto, comma separated.")
+	flag.Var(&machineList, "machines", "List of machines to schedule onto, comma separated. If empty, the machines whose kubelets have registered themselves in etcd are used.")
 }
 
 func main() {
 	flag.Parse()
 
-	if len(machineList) == 0 {
-		log.Fatal("No machines specified!")
-	}
-
 	if len(etcdServerList) == 0 {
 		log.Fatal("No etcd servers specified!")
 	}
@@ -58,25 +55,31 @@ func main() {
 	var (
 		taskRegistry       registry.TaskRegistry
 		controllerRegistry registry.ControllerRegistry
-		// TODO: service has not implemented yet..
-		// serviceRegistry    registry.ServiceRegistry
+		serviceRegistry    registry.ServiceRegistry
+		minionRegistry     registry.MinionRegistry
 	)
 
 	log.Printf("Creating etcd client pointing to %v", etcdServerList)
 	etcdClient := etcd.NewClient(etcdServerList)
-	taskRegistry = registry.MakeEtcdRegistry(etcdClient, machineList)
-	controllerRegistry = registry.MakeEtcdRegistry(etcdClient, machineList)
-	// serviceRegistry = registry.MakeEtcdRegistry(etcdClient, machineList)
+	if len(machineList) == 0 {
+		minionRegistry = registry.MakeEtcdMinionRegistry(etcdClient)
+	} else {
+		minionRegistry = registry.MakeStaticMinionRegistry(machineList)
+	}
+	taskRegistry = registry.MakeEtcdRegistry(etcdClient, minionRegistry)
+	controllerRegistry = registry.MakeEtcdRegistry(etcdClient, minionRegistry)
+	serviceRegistry = registry.MakeEtcdRegistry(etcdClient, minionRegistry)
 
 	containerInfo := &kubeClient.HTTPContainerInfo{
-		Client: http.DefaultClient,
-		Port:   10250,
+		Client: &http.Client{Timeout: 5 * time.Second},
+		Port:   *kubeletPort,
 	}
 
 	storage := map[string]apiserver.RESTStorage{
-		"tasks":                  registry.MakeTaskRegistryStorage(taskRegistry, containerInfo, registry.MakeFirstFitScheduler(machineList, taskRegistry)),
+		"tasks":                  registry.MakeTaskRegistryStorage(taskRegistry, containerInfo, registry.MakeFirstFitScheduler(minionRegistry, taskRegistry)),
 		"replicationControllers": registry.MakeControllerRegistryStorage(controllerRegistry),
-		// "services":               registry.MakeServiceRegistryStorage(serviceRegistry),
+		"services":               registry.MakeServiceRegistryStorage(serviceRegistry),
+		"minions":                registry.MakeMinionRegistryStorage(minionRegistry),
 	}
 
 	s := &http.Server{
@@ -15,7 +15,8 @@ limitations under the License.
 */
 // The controller manager is responsible for monitoring replication controllers, and creating corresponding
 // tasks to achieve the desired state.  It listens for new controllers in etcd, and it sends requests to the
-// master to create/delete tasks.
+// master to create/delete tasks. It also keeps the endpoints of every service in sync with the tasks
+// that match the service's labels, and evicts the tasks of machines whose kubelet stopped heartbeating.
 //
 // TODO: Refactor the etcd watch code so that it is a pluggable interface.
 package main
@@ -33,8 +34,10 @@ import (
 )
 
 var (
-	etcdServers = flag.String("etcd_servers", "", "Servers for the etcd (http://ip:port).")
-	master      = flag.String("master", "", "The address of the Kubernetes API server")
+	etcdServers           = flag.String("etcd_servers", "", "Servers for the etcd (http://ip:port).")
+	master                = flag.String("master", "", "The address of the Kubernetes API server")
+	minionGracePeriod     = flag.Duration("minion_grace_period", 40*time.Second, "How long a minion may miss its heartbeats before it is marked NotReady")
+	minionEvictionTimeout = flag.Duration("minion_eviction_timeout", 5*time.Minute, "How long a minion may miss its heartbeats before its tasks are deleted. Keep it below the minion record TTL of 10m")
 )
 
 func main() {
@@ -47,12 +50,27 @@ func main() {
 	// Set up logger for etcd client
 	etcd.SetLogger(log.New(os.Stderr, "etcd ", log.LstdFlags))
 
-	controllerManager := registry.MakeReplicationManager(etcd.NewClient([]string{*etcdServers}),
-		kubeClient.Client{
-			Host: "http://" + *master,
-		})
+	etcdClient := etcd.NewClient([]string{*etcdServers})
+	client := kubeClient.Client{
+		Host: "http://" + *master,
+	}
+	controllerManager := registry.MakeReplicationManager(etcdClient, client)
+	// The endpoints controller only uses the service half of the registry, which doesn't need machines.
+	endpointController := registry.MakeEndpointController(registry.MakeEtcdRegistry(etcdClient, nil), client)
+	minionController := registry.MakeMinionController(etcdClient, client, *minionGracePeriod, *minionEvictionTimeout)
 
 	go util.Forever(func() { controllerManager.Synchronize() }, 20*time.Second)
 	go util.Forever(func() { controllerManager.WatchControllers() }, 20*time.Second)
+	go util.Forever(func() {
+		if err := endpointController.SyncServiceEndpoints(); err != nil {
+			log.Printf("Error syncing endpoints: %v", err)
+		}
+	}, 10*time.Second)
+	go util.Forever(func() { endpointController.WatchTasks() }, 20*time.Second)
+	go util.Forever(func() {
+		if err := minionController.SyncMinions(); err != nil {
+			log.Printf("Error syncing minions: %v", err)
+		}
+	}, 5*time.Second)
 	select {}
 }
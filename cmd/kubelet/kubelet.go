@@ -24,6 +24,9 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	goruntime "runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -41,6 +44,12 @@ var (
 	address            = flag.String("address", "127.0.0.1", "The address for the info server to serve on")
 	port               = flag.Uint("port", 10250, "The port for the info server to serve on")
 	hostnameOverride   = flag.String("hostname_override", "", "If non-empty, will use this string as identification instead of the actual hostname.")
+	dockercfgPath      = flag.String("dockercfg_path", "", "Path to a dockercfg file with registry credentials. Defaults to the docker configuration of the user running the kubelet")
+	memoryCapacity     = flag.Int("memory_capacity", 0, "Memory in bytes available to tasks on this machine. Defaults to the machine's total memory")
+	cpuCapacity        = flag.Int("cpu_capacity", 0, "CPU in thousandths of a core available to tasks on this machine. Defaults to all of the machine's cores")
+	rootDirectory      = flag.String("root_dir", "/var/lib/kubelet", "Directory the kubelet keeps task data, such as emptyDir volumes, in")
+	networkImage       = flag.String("network_container_image", "registry.k8s.io/pause:3.9", "Image of the container holding the network of each task, with the docker runtime")
+	runtime            = flag.String("runtime", "docker", "The container runtime to use: 'docker', or 'process' to run container commands as host processes")
 )
 
 const dockerBinary = "/usr/bin/docker"
@@ -51,12 +60,33 @@ func main() {
 	// Set up logger for etcd client
 	etcd.SetLogger(log.New(os.Stderr, "etcd ", log.LstdFlags))
 
-	endpoint := "unix:///var/run/docker.sock"
-	dockerClient, err := docker.NewClient(endpoint)
-	if err != nil {
-		log.Fatal("Couldn't connnect to docker.")
+	var containerRuntime kubelet.ContainerRuntime
+	networkContainerImage := ""
+	switch *runtime {
+	case "docker":
+		endpoint := "unix:///var/run/docker.sock"
+		dockerClient, err := docker.NewClient(endpoint)
+		if err != nil {
+			log.Fatal("Couldn't connnect to docker.")
+		}
+		var auth *docker.AuthConfigurations
+		if len(*dockercfgPath) > 0 {
+			auth, err = docker.NewAuthConfigurationsFromFile(*dockercfgPath)
+			if err != nil {
+				log.Fatalf("Couldn't read registry credentials from %s: %v", *dockercfgPath, err)
+			}
+		} else if auth, err = docker.NewAuthConfigurationsFromDockerCfg(); err != nil {
+			log.Printf("Pulling images without registry credentials: %v", err)
+		}
+		containerRuntime = kubelet.MakeDockerRuntime(dockerClient, auth)
+		networkContainerImage = *networkImage
+	case "process":
+		containerRuntime = kubelet.MakeProcessRuntime()
+	default:
+		log.Fatalf("Unknown container runtime: %s", *runtime)
 	}
 
+	var err error
 	hostname := []byte(*hostnameOverride)
 	if string(hostname) == "" {
 		hostname, err = exec.Command("hostname", "-f").Output()
@@ -66,11 +96,41 @@ func main() {
 	}
 
 	myKubelet := kubelet.Kubelet{
-		DockerClient:       dockerClient,
-		FileCheckFrequency: *fileCheckFrequency,
-		SyncFrequency:      *syncFrequency,
-		HTTPCheckFrequency: *httpCheckFrequency,
-		Hostname:           string(hostname),
+		Runtime:               containerRuntime,
+		FileCheckFrequency:    *fileCheckFrequency,
+		SyncFrequency:         *syncFrequency,
+		HTTPCheckFrequency:    *httpCheckFrequency,
+		Hostname:              string(hostname),
+		RootDirectory:         *rootDirectory,
+		NetworkContainerImage: networkContainerImage,
+		MemoryCapacity:        *memoryCapacity,
+		CPUCapacity:           *cpuCapacity,
+	}
+	if myKubelet.MemoryCapacity == 0 {
+		myKubelet.MemoryCapacity = machineMemory()
+	}
+	if myKubelet.CPUCapacity == 0 {
+		myKubelet.CPUCapacity = goruntime.NumCPU() * 1000
 	}
 	myKubelet.RunKubelet(*file, *manifestURL, *etcdServers, *address, *port)
 }
+
+// Returns the total memory of this machine in bytes, or 0 if it can't be determined.
+func machineMemory() int {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// The proxy runs on every machine next to the kubelet. It listens on the port of every
+// service, and forwards each connection to one of the service's endpoints, round-robin.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/proxy"
+	"github.com/kawabatas/toy-k8s/pkg/util"
+	"github.com/kawabatas/toy-k8s/third_party/github.com/coreos/go-etcd/etcd"
+)
+
+var (
+	etcdServers  = flag.String("etcd_servers", "", "Servers for the etcd (http://ip:port).")
+	bindAddress  = flag.String("bind_address", "0.0.0.0", "The address for the proxy to listen on for service ports")
+	resyncPeriod = flag.Duration("resync_period", 30*time.Second, "Max time between re-reading services and endpoints from etcd")
+)
+
+func main() {
+	flag.Parse()
+
+	if len(*etcdServers) == 0 {
+		log.Fatal("usage: proxy -etcd_servers <servers>")
+	}
+
+	// Set up logger for etcd client
+	etcd.SetLogger(log.New(os.Stderr, "etcd ", log.LstdFlags))
+
+	loadBalancer := proxy.NewLoadBalancerRR()
+	proxier := proxy.NewProxier(loadBalancer, *bindAddress)
+	config := proxy.NewConfigSourceEtcd(etcd.NewClient([]string{*etcdServers}), proxier, loadBalancer, *resyncPeriod)
+
+	util.Forever(func() { config.Run() }, 5*time.Second)
+}
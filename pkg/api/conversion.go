@@ -0,0 +1,96 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// CommandLine is a list of arguments, passed to the container unchanged. It can also be
+// decoded from a single string, which is split on white space.
+type CommandLine []string
+
+func (c *CommandLine) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*c = list
+		return nil
+	}
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	*c = strings.Fields(legacy)
+	return nil
+}
+
+func (c *CommandLine) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*c = list
+		return nil
+	}
+	var legacy string
+	if err := unmarshal(&legacy); err != nil {
+		return err
+	}
+	*c = strings.Fields(legacy)
+	return nil
+}
+
+// UnmarshalJSON decodes a container, converting a legacy command. See convertLegacyCommand.
+func (c *Container) UnmarshalJSON(data []byte) error {
+	type container Container
+	if err := json.Unmarshal(data, (*container)(c)); err != nil {
+		return err
+	}
+	var command struct {
+		Command interface{} `json:"command"`
+	}
+	if err := json.Unmarshal(data, &command); err != nil {
+		return err
+	}
+	c.convertLegacyCommand(command.Command)
+	return nil
+}
+
+// UnmarshalYAML decodes a container, converting a legacy command. See convertLegacyCommand.
+func (c *Container) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type container Container
+	if err := unmarshal((*container)(c)); err != nil {
+		return err
+	}
+	var command struct {
+		Command interface{} `yaml:"command"`
+	}
+	if err := unmarshal(&command); err != nil {
+		return err
+	}
+	c.convertLegacyCommand(command.Command)
+	return nil
+}
+
+// Older manifests give the command as a single string, which was run as the image's default
+// arguments (docker's Cmd), after the image's entrypoint. Such a command is moved to Args,
+// so that it is still run that way, unless Args is set as well.
+func (c *Container) convertLegacyCommand(command interface{}) {
+	if _, legacy := command.(string); legacy && len(c.Args) == 0 {
+		c.Args = c.Command
+		c.Command = nil
+	}
+}
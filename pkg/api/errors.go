@@ -0,0 +1,106 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// StatusError is an error intended for consumption by a REST API server; it can also be
+// reconstructed by clients from a REST response.
+type StatusError struct {
+	ErrStatus Status
+}
+
+// Error implements the Error interface.
+func (e *StatusError) Error() string {
+	return e.ErrStatus.Message
+}
+
+// Status returns the Status object that describes this error.
+func (e *StatusError) Status() Status {
+	return e.ErrStatus
+}
+
+func newStatusError(reason StatusReason, code int, message string) *StatusError {
+	return &StatusError{Status{
+		JSONBase: JSONBase{Kind: "Status"},
+		Status:   StatusFailure,
+		Reason:   reason,
+		Message:  message,
+		Code:     code,
+	}}
+}
+
+// NewBadRequest returns an error indicating the request body could not be decoded.
+func NewBadRequest(reason string) error {
+	return newStatusError(StatusReasonBadRequest, http.StatusBadRequest, reason)
+}
+
+// NewNotFound returns an error indicating the resource of kind 'kind' and name 'name' was not found.
+func NewNotFound(kind, name string) error {
+	return newStatusError(StatusReasonNotFound, http.StatusNotFound, fmt.Sprintf("%s %q not found", kind, name))
+}
+
+// NewAlreadyExists returns an error indicating the resource of kind 'kind' and name 'name' already exists.
+func NewAlreadyExists(kind, name string) error {
+	return newStatusError(StatusReasonAlreadyExists, http.StatusConflict, fmt.Sprintf("%s %q already exists", kind, name))
+}
+
+// NewConflict returns an error indicating the item can't be updated as provided.
+func NewConflict(kind, name string, err error) error {
+	return newStatusError(StatusReasonConflict, http.StatusConflict, fmt.Sprintf("%s %q cannot be updated: %v", kind, name, err))
+}
+
+// NewInvalid returns an error indicating the item is invalid and cannot be processed.
+func NewInvalid(kind, name, message string) error {
+	return newStatusError(StatusReasonInvalid, http.StatusUnprocessableEntity, fmt.Sprintf("%s %q is invalid: %s", kind, name, message))
+}
+
+// NewMethodNotSupported returns an error indicating the requested action is not supported on 'kind'.
+func NewMethodNotSupported(kind, action string) error {
+	return newStatusError(StatusReasonMethodNotAllowed, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not supported on resources of kind %q", action, kind))
+}
+
+// IsNotFound returns true if the specified error was created by NewNotFound.
+func IsNotFound(err error) bool {
+	return reasonForError(err) == StatusReasonNotFound
+}
+
+// IsAlreadyExists determines if the err is an error which indicates that a specified resource already exists.
+func IsAlreadyExists(err error) bool {
+	return reasonForError(err) == StatusReasonAlreadyExists
+}
+
+// IsConflict determines if the err is an error which indicates the provided update conflicts.
+func IsConflict(err error) bool {
+	return reasonForError(err) == StatusReasonConflict
+}
+
+// IsInvalid determines if the err is an error which indicates the provided resource is not valid.
+func IsInvalid(err error) bool {
+	return reasonForError(err) == StatusReasonInvalid
+}
+
+func reasonForError(err error) StatusReason {
+	switch t := err.(type) {
+	case *StatusError:
+		return t.ErrStatus.Reason
+	}
+	return StatusReasonUnknown
+}
@@ -18,6 +18,10 @@ limitations under the License.
 // parts of the Kubernetes system.
 package api
 
+import (
+	"time"
+)
+
 // ContainerManifest corresponds to the Container Manifest format, documented at:
 // https://developers.google.com/compute/docs/containers#container_manifest
 // This is used as the representation of Kubernete's workloads.
@@ -26,19 +30,59 @@ type ContainerManifest struct {
 	Volumes    []Volume    `yaml:"volumes" json:"volumes"`
 	Containers []Container `yaml:"containers" json:"containers"`
 	Id         string      `yaml:"id,omitempty" json:"id,omitempty"`
+	// What the kubelet does when a container exits. Defaults to RestartAlways.
+	RestartPolicy RestartPolicy `yaml:"restartPolicy,omitempty" json:"restartPolicy,omitempty"`
 }
 
+// RestartPolicy describes when the kubelet restarts the containers of a manifest which exited.
+type RestartPolicy string
+
+const (
+	RestartAlways RestartPolicy = "Always"
+	// Only restart containers which exited with a non zero code.
+	RestartOnFailure RestartPolicy = "OnFailure"
+	RestartNever     RestartPolicy = "Never"
+)
+
 type Volume struct {
 	Name string `yaml:"name" json:"name"`
+	// Where the volume's files come from. Volumes without a source are the host
+	// directory /exports/<name>.
+	Source *VolumeSource `yaml:"source,omitempty" json:"source,omitempty"`
+}
+
+// VolumeSource describes the directory backing a volume. Exactly one of its fields should be set.
+type VolumeSource struct {
+	HostDir  *HostDir  `yaml:"hostDir,omitempty" json:"hostDir,omitempty"`
+	EmptyDir *EmptyDir `yaml:"emptyDir,omitempty" json:"emptyDir,omitempty"`
+}
+
+// HostDir is a volume backed by an existing directory of the host.
+type HostDir struct {
+	Path string `yaml:"path" json:"path"`
 }
 
+// EmptyDir is a volume backed by a scratch directory, which the kubelet creates empty for the
+// task and deletes along with it. It is shared by all the containers of the task.
+type EmptyDir struct{}
+
 type Port struct {
-	Name          string `yaml:"name,omitempty" json:"name,omitempty"`
-	HostPort      int    `yaml:"hostPort,omitempty" json:"hostPort,omitempty"`
-	ContainerPort int    `yaml:"containerPort,omitempty" json:"containerPort,omitempty"`
-	Protocol      string `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// The port of the host the container port is published on. 0 means it isn't published.
+	HostPort      int `yaml:"hostPort,omitempty" json:"hostPort,omitempty"`
+	ContainerPort int `yaml:"containerPort,omitempty" json:"containerPort,omitempty"`
+	// ProtocolTCP or ProtocolUDP, case insensitive. Defaults to ProtocolTCP.
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	// The host address HostPort is bound on. Defaults to all addresses.
+	HostIP string `yaml:"hostIP,omitempty" json:"hostIP,omitempty"`
 }
 
+// Values of Port.Protocol
+const (
+	ProtocolTCP = "TCP"
+	ProtocolUDP = "UDP"
+)
+
 type VolumeMount struct {
 	Name      string `yaml:"name,omitempty" json:"name,omitempty"`
 	ReadOnly  bool   `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
@@ -50,17 +94,89 @@ type EnvVar struct {
 	Value string `yaml:"value,omitempty" json:"value,omitempty"`
 }
 
+// PullPolicy describes when the kubelet pulls the image of a container.
+type PullPolicy string
+
+const (
+	// Pull the image every time the container is started.
+	PullAlways PullPolicy = "Always"
+	// Only pull the image if it isn't on the host yet.
+	PullIfNotPresent PullPolicy = "IfNotPresent"
+	// Never pull the image, it must already be on the host.
+	PullNever PullPolicy = "Never"
+)
+
 // Container represents a single container that is expected to be run on the host.
 type Container struct {
-	Name         string        `yaml:"name,omitempty" json:"name,omitempty"`
-	Image        string        `yaml:"image,omitempty" json:"image,omitempty"`
-	Command      string        `yaml:"command,omitempty" json:"command,omitempty"`
-	WorkingDir   string        `yaml:"workingDir,omitempty" json:"workingDir,omitempty"`
-	Ports        []Port        `yaml:"ports,omitempty" json:"ports,omitempty"`
-	Env          []EnvVar      `yaml:"env,omitempty" json:"env,omitempty"`
-	Memory       int           `yaml:"memory,omitempty" json:"memory,omitempty"`
+	Name  string `yaml:"name,omitempty" json:"name,omitempty"`
+	Image string `yaml:"image,omitempty" json:"image,omitempty"`
+	// The executable to run, with any leading arguments. Replaces the image's entrypoint
+	// when set. A command given as a single string is decoded into Args instead, see
+	// Container.convertLegacyCommand.
+	Command CommandLine `yaml:"command,omitempty" json:"command,omitempty"`
+	// The arguments to the command, which replace the image's default arguments (docker's Cmd).
+	Args       CommandLine `yaml:"args,omitempty" json:"args,omitempty"`
+	WorkingDir string      `yaml:"workingDir,omitempty" json:"workingDir,omitempty"`
+	Ports      []Port      `yaml:"ports,omitempty" json:"ports,omitempty"`
+	Env        []EnvVar    `yaml:"env,omitempty" json:"env,omitempty"`
+	// Memory limit, in bytes. 0 means unlimited.
+	Memory int `yaml:"memory,omitempty" json:"memory,omitempty"`
+	// CPU, in thousandths of a core, so 1000 is one core. It sets the container's share of
+	// the CPU relative to other containers, 0 means the default share.
 	CPU          int           `yaml:"cpu,omitempty" json:"cpu,omitempty"`
 	VolumeMounts []VolumeMount `yaml:"volumeMounts,omitempty" json:"volumeMounts,omitempty"`
+	// Defaults to Always for images without a tag or tagged latest, and IfNotPresent otherwise.
+	ImagePullPolicy PullPolicy `yaml:"imagePullPolicy,omitempty" json:"imagePullPolicy,omitempty"`
+	// If set, the kubelet restarts the container when the probe keeps failing.
+	LivenessProbe *LivenessProbe `yaml:"livenessProbe,omitempty" json:"livenessProbe,omitempty"`
+	// If set, the container only counts as ready to serve while the probe succeeds.
+	ReadinessProbe *ReadinessProbe `yaml:"readinessProbe,omitempty" json:"readinessProbe,omitempty"`
+}
+
+// LivenessProbe describes how the kubelet checks that a running container is healthy.
+// Exactly one of HTTPGet, TCPSocket and Exec should be set.
+type LivenessProbe struct {
+	HTTPGet   *HTTPGetProbe   `yaml:"httpGet,omitempty" json:"httpGet,omitempty"`
+	TCPSocket *TCPSocketProbe `yaml:"tcpSocket,omitempty" json:"tcpSocket,omitempty"`
+	Exec      *ExecProbe      `yaml:"exec,omitempty" json:"exec,omitempty"`
+	// How long after the container started to wait before probing it.
+	InitialDelaySeconds int64 `yaml:"initialDelaySeconds,omitempty" json:"initialDelaySeconds,omitempty"`
+	// How long a probe may take before it fails. Defaults to 1 second.
+	TimeoutSeconds int64 `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+	// How many probes in a row must fail before the container is restarted. Defaults to 3.
+	FailureThreshold int `yaml:"failureThreshold,omitempty" json:"failureThreshold,omitempty"`
+}
+
+// ReadinessProbe describes how the kubelet checks that a running container is ready to serve
+// traffic. Exactly one of HTTPGet, TCPSocket and Exec should be set, they work as in LivenessProbe.
+type ReadinessProbe struct {
+	HTTPGet   *HTTPGetProbe   `yaml:"httpGet,omitempty" json:"httpGet,omitempty"`
+	TCPSocket *TCPSocketProbe `yaml:"tcpSocket,omitempty" json:"tcpSocket,omitempty"`
+	Exec      *ExecProbe      `yaml:"exec,omitempty" json:"exec,omitempty"`
+	// How long after the container started it is assumed not to be ready, before probing it.
+	InitialDelaySeconds int64 `yaml:"initialDelaySeconds,omitempty" json:"initialDelaySeconds,omitempty"`
+	// How long a probe may take before it fails. Defaults to 1 second.
+	TimeoutSeconds int64 `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+}
+
+// HTTPGetProbe succeeds if a GET of Path returns a 2xx or 3xx status.
+type HTTPGetProbe struct {
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// The number, or the name of one of the container's ports.
+	Port string `yaml:"port,omitempty" json:"port,omitempty"`
+	// Defaults to the address of the container.
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+}
+
+// TCPSocketProbe succeeds if a TCP connection to Port can be opened.
+type TCPSocketProbe struct {
+	// The number, or the name of one of the container's ports.
+	Port string `yaml:"port,omitempty" json:"port,omitempty"`
+}
+
+// ExecProbe succeeds if Command, run inside the container, exits with code 0.
+type ExecProbe struct {
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
 }
 
 // Event is the representation of an event logged to etcd backends
@@ -79,8 +195,120 @@ type JSONBase struct {
 	ID                string `json:"id,omitempty" yaml:"id,omitempty"`
 	CreationTimestamp string `json:"creationTimestamp,omitempty" yaml:"creationTimestamp,omitempty"`
 	SelfLink          string `json:"selfLink,omitempty" yaml:"selfLink,omitempty"`
+	// ResourceVersion is the etcd index at which the object was last modified. Send it
+	// back unchanged on update; the update is rejected as a conflict if the object has
+	// been modified since. A zero value skips the check.
+	ResourceVersion uint64 `json:"resourceVersion,omitempty" yaml:"resourceVersion,omitempty"`
+}
+
+// Status is a return value for calls that don't return other objects.
+// It lives here rather than in apiserver so that clients needn't import both.
+type Status struct {
+	JSONBase
+	// One of: "success", "failure"
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+	// A machine-readable description of why this operation is in the
+	// "failure" status. If this value is empty there is no information
+	// available.
+	Reason StatusReason `json:"reason,omitempty" yaml:"reason,omitempty"`
+	// A human-readable description of the status of this operation.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+	// Suggested HTTP return code for this status, 0 if not set.
+	Code int `json:"code,omitempty" yaml:"code,omitempty"`
 }
 
+// Values of Status.Status
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// StatusReason is an enumeration of possible failure causes. Each StatusReason
+// must map to a single HTTP status code, but multiple reasons may map
+// to the same HTTP status code.
+type StatusReason string
+
+const (
+	// StatusReasonUnknown means the server has declined to indicate a specific reason.
+	// Status code 500.
+	StatusReasonUnknown StatusReason = ""
+
+	// StatusReasonBadRequest means the request body could not be decoded.
+	// Status code 400.
+	StatusReasonBadRequest StatusReason = "bad_request"
+
+	// StatusReasonNotFound means one or more resources required for this operation
+	// could not be found.
+	// Status code 404.
+	StatusReasonNotFound StatusReason = "not_found"
+
+	// StatusReasonAlreadyExists means the resource you are creating already exists.
+	// Status code 409.
+	StatusReasonAlreadyExists StatusReason = "already_exists"
+
+	// StatusReasonConflict means the requested update operation cannot be completed
+	// due to a conflict in the operation.
+	// Status code 409.
+	StatusReasonConflict StatusReason = "conflict"
+
+	// StatusReasonInvalid means the requested create or update operation cannot be
+	// completed due to invalid data provided as part of the request.
+	// Status code 422.
+	StatusReasonInvalid StatusReason = "invalid"
+
+	// StatusReasonMethodNotAllowed means that the action the client attempted to perform
+	// on the resource was not supported by the code.
+	// Status code 405.
+	StatusReasonMethodNotAllowed StatusReason = "method_not_allowed"
+)
+
+// ContainerStateWaiting is the state of a container which isn't running yet, e.g. because
+// its image is still being pulled.
+type ContainerStateWaiting struct {
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// ContainerStateRunning is the state of a running container.
+type ContainerStateRunning struct {
+	StartedAt time.Time `json:"startedAt,omitempty" yaml:"startedAt,omitempty"`
+}
+
+// ContainerStateTerminated is the state of a container which has exited.
+type ContainerStateTerminated struct {
+	ExitCode   int       `json:"exitCode" yaml:"exitCode"`
+	Reason     string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+	StartedAt  time.Time `json:"startedAt,omitempty" yaml:"startedAt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitempty" yaml:"finishedAt,omitempty"`
+}
+
+// ContainerState holds exactly one of the possible states of a container.
+type ContainerState struct {
+	Waiting    *ContainerStateWaiting    `json:"waiting,omitempty" yaml:"waiting,omitempty"`
+	Running    *ContainerStateRunning    `json:"running,omitempty" yaml:"running,omitempty"`
+	Terminated *ContainerStateTerminated `json:"terminated,omitempty" yaml:"terminated,omitempty"`
+}
+
+// ContainerStatus is the state of a container, as reported by the kubelet running it.
+type ContainerStatus struct {
+	State ContainerState `json:"state,omitempty" yaml:"state,omitempty"`
+	// The docker ID of the container, empty if it hasn't been created yet.
+	ContainerID string `json:"containerID,omitempty" yaml:"containerID,omitempty"`
+	// How many times the container was restarted after it exited.
+	RestartCount int `json:"restartCount" yaml:"restartCount"`
+	// Whether the container is running and passes its readiness probe, if it has one.
+	Ready bool `json:"ready,omitempty" yaml:"ready,omitempty"`
+}
+
+// Values of TaskState.Status, as reported by the kubelet.
+const (
+	// At least one container of the task isn't running yet.
+	TaskWaiting = "Waiting"
+	// All containers of the task have been started, and not all of them have exited.
+	TaskRunning = "Running"
+	// All containers of the task have exited.
+	TaskTerminated = "Terminated"
+)
+
 // TaskState is the state of a task, used as either input (desired state) or output (current state)
 type TaskState struct {
 	Manifest ContainerManifest `json:"manifest,omitempty" yaml:"manifest,omitempty"`
@@ -88,6 +316,10 @@ type TaskState struct {
 	Host     string            `json:"host,omitempty" yaml:"host,omitempty"`
 	HostIP   string            `json:"hostIP,omitempty" yaml:"hostIP,omitempty"`
 	Info     interface{}       `json:"info,omitempty" yaml:"info,omitempty"`
+	// The state of each container of the task, keyed by container name.
+	ContainerStatuses map[string]ContainerStatus `json:"containerStatuses,omitempty" yaml:"containerStatuses,omitempty"`
+	// Whether every container of the task is ready, so the task can receive service traffic.
+	Ready bool `json:"ready,omitempty" yaml:"ready,omitempty"`
 }
 
 type TaskList struct {
@@ -128,8 +360,39 @@ type TaskTemplate struct {
 	Labels       map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
 }
 
+// Minion is a machine which has registered itself to run tasks. Its ID is the machine's hostname.
+type Minion struct {
+	JSONBase
+	// The address the minion's kubelet serves on, may be empty.
+	HostIP string `json:"hostIP,omitempty" yaml:"hostIP,omitempty"`
+	// One of MinionReady or MinionNotReady.
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+	// Unix time of the last heartbeat of the minion's kubelet.
+	LastHeartbeat int64 `json:"lastHeartbeat,omitempty" yaml:"lastHeartbeat,omitempty"`
+	// Memory available to tasks, in bytes. 0 means unknown, and isn't checked by the scheduler.
+	MemoryCapacity int `json:"memoryCapacity,omitempty" yaml:"memoryCapacity,omitempty"`
+	// CPU available to tasks, in thousandths of a core like Container.CPU. 0 means unknown.
+	CPUCapacity int `json:"cpuCapacity,omitempty" yaml:"cpuCapacity,omitempty"`
+}
+
+// Values of Minion.Status
+const (
+	// The minion's kubelet is heartbeating, tasks can be scheduled onto it.
+	MinionReady = "Ready"
+	// The minion's kubelet has missed its heartbeats for longer than a grace period.
+	// Its tasks are kept until they are evicted, but no new tasks are scheduled onto it.
+	MinionNotReady = "NotReady"
+)
+
+// MinionList is a list of minions.
+type MinionList struct {
+	JSONBase
+	Items []Minion `json:"items,omitempty" yaml:"items,omitempty"`
+}
+
 // ServiceList holds a list of services
 type ServiceList struct {
+	JSONBase
 	Items []Service `json:"items" yaml:"items"`
 }
 
@@ -144,6 +407,6 @@ type Service struct {
 // Defines the endpoints that implement the actual service, for example:
 // Name: "mysql", Endpoints: ["10.10.1.1:1909", "10.10.2.2:8834"]
 type Endpoints struct {
-	Name      string
-	Endpoints []string
+	Name      string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
 }
@@ -25,6 +25,10 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/watch"
 )
 
 // RESTStorage is a generic interface for RESTful storage services
@@ -37,9 +41,16 @@ type RESTStorage interface {
 	Update(interface{}) error
 }
 
+// ResourceWatcher should be implemented by all RESTStorage objects that
+// want to offer the ability to watch for changes through the watch api.
+type ResourceWatcher interface {
+	Watch(*url.URL) (watch.Interface, error)
+}
+
 // ApiServer is an HTTPHandler that delegates to RESTStorage objects.
 // It handles URLs of the form:
 // ${prefix}/${storage_key}[/${object_name}]
+// ${prefix}/watch/${storage_key}
 // Where 'prefix' is an arbitrary string, and 'storage_key' points to a RESTStorage object stored in storage.
 //
 // TODO: consider migrating this to go-restful which is a more full-featured version of the same thing.
@@ -79,6 +90,10 @@ func (server *ApiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		server.notFound(req, w)
 		return
 	}
+	if requestParts[0] == "watch" {
+		server.handleWatch(requestParts[1:], url, req, w)
+		return
+	}
 	storage := server.storage[requestParts[0]]
 	if storage == nil {
 		server.notFound(req, w)
@@ -88,6 +103,55 @@ func (server *ApiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// handleWatch streams the changes to a resource as a series of JSON encoded watch.Events,
+// until either the watch ends or the client goes away.
+func (server *ApiServer) handleWatch(parts []string, url *url.URL, req *http.Request, w http.ResponseWriter) {
+	if req.Method != "GET" || len(parts) != 1 {
+		server.notFound(req, w)
+		return
+	}
+	watcher, ok := server.storage[parts[0]].(ResourceWatcher)
+	if !ok {
+		server.notFound(req, w)
+		return
+	}
+	watching, err := watcher.Watch(url)
+	if err != nil {
+		server.error(err, w)
+		return
+	}
+	defer watching.Stop()
+
+	// A watch outlives any write timeout configured on the server.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		server.error(fmt.Errorf("unable to start watch - can't get http.Flusher: %#v", w), w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case event, ok := <-watching.ResultChan():
+			if !ok {
+				// End of results.
+				return
+			}
+			if err := encoder.Encode(&event); err != nil {
+				log.Printf("Error writing watch event: %v", err)
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
 func (server *ApiServer) handleIndex(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusOK)
 	// TODO: serve this out of a file?
@@ -96,23 +160,48 @@ func (server *ApiServer) handleIndex(w http.ResponseWriter) {
 }
 
 func (server *ApiServer) notFound(req *http.Request, w http.ResponseWriter) {
-	w.WriteHeader(404)
-	fmt.Fprintf(w, "Not Found: %#v", req)
+	server.writeStatus(api.Status{
+		JSONBase: api.JSONBase{Kind: "Status"},
+		Status:   api.StatusFailure,
+		Reason:   api.StatusReasonNotFound,
+		Message:  fmt.Sprintf("Not Found: %s %s", req.Method, req.URL.Path),
+		Code:     http.StatusNotFound,
+	}, w)
 }
 
 func (server *ApiServer) write(statusCode int, object interface{}, w http.ResponseWriter) {
-	w.WriteHeader(statusCode)
 	output, err := json.MarshalIndent(object, "", "    ")
 	if err != nil {
 		server.error(err, w)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 	w.Write(output)
 }
 
+// error writes err as an api.Status. Errors which carry a status of their own (see
+// api.StatusError) keep their reason and code, anything else is an internal error.
 func (server *ApiServer) error(err error, w http.ResponseWriter) {
-	w.WriteHeader(500)
-	fmt.Fprintf(w, "Internal Error: %#v", err)
+	if statusErr, ok := err.(*api.StatusError); ok {
+		server.writeStatus(statusErr.Status(), w)
+		return
+	}
+	server.writeStatus(api.Status{
+		JSONBase: api.JSONBase{Kind: "Status"},
+		Status:   api.StatusFailure,
+		Reason:   api.StatusReasonUnknown,
+		Message:  err.Error(),
+		Code:     http.StatusInternalServerError,
+	}, w)
+}
+
+func (server *ApiServer) writeStatus(status api.Status, w http.ResponseWriter) {
+	code := status.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	server.write(code, status, w)
 }
 
 func (server *ApiServer) readBody(req *http.Request) (string, error) {
@@ -132,6 +221,17 @@ func (server *ApiServer) handleREST(parts []string, url *url.URL, req *http.Requ
 				return
 			}
 			server.write(200, controllers, w)
+		case 2:
+			item, err := storage.Get(parts[1])
+			if err != nil {
+				server.error(err, w)
+				return
+			}
+			if item == nil {
+				server.notFound(req, w)
+				return
+			}
+			server.write(200, item, w)
 		default:
 			server.notFound(req, w)
 		}
@@ -147,11 +247,63 @@ func (server *ApiServer) handleREST(parts []string, url *url.URL, req *http.Requ
 			return
 		}
 		obj, err := storage.Extract(body)
+		if err != nil {
+			server.error(api.NewBadRequest(err.Error()), w)
+			return
+		}
+		err = storage.Create(obj)
+		if err != nil {
+			server.error(err, w)
+			return
+		}
+		server.write(200, obj, w)
+		return
+	case "DELETE":
+		if len(parts) != 2 {
+			server.notFound(req, w)
+			return
+		}
+		err := storage.Delete(parts[1])
+		if err != nil {
+			server.error(err, w)
+			return
+		}
+		server.writeStatus(api.Status{
+			JSONBase: api.JSONBase{Kind: "Status"},
+			Status:   api.StatusSuccess,
+			Code:     http.StatusOK,
+		}, w)
+		return
+	case "PUT":
+		if len(parts) != 2 {
+			server.notFound(req, w)
+			return
+		}
+		body, err := server.readBody(req)
+		if err != nil {
+			server.error(err, w)
+			return
+		}
+		// The object to update is the one named by the URL, whatever the body names.
+		var base api.JSONBase
+		if err := json.Unmarshal([]byte(body), &base); err != nil {
+			server.error(api.NewBadRequest(err.Error()), w)
+			return
+		}
+		if base.ID != parts[1] {
+			server.error(api.NewBadRequest(fmt.Sprintf("id %q in the body doesn't match %q in the URL", base.ID, parts[1])), w)
+			return
+		}
+		obj, err := storage.Extract(body)
+		if err != nil {
+			server.error(api.NewBadRequest(err.Error()), w)
+			return
+		}
+		err = storage.Update(obj)
 		if err != nil {
 			server.error(err, w)
 			return
 		}
-		storage.Create(obj)
 		server.write(200, obj, w)
 		return
 	default:
@@ -24,6 +24,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -34,6 +35,8 @@ import (
 	"strings"
 
 	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/util"
+	"github.com/kawabatas/toy-k8s/pkg/watch"
 )
 
 // ClientInterface holds the methods for clients of Kubenetes, an interface to allow mock testing
@@ -49,7 +52,14 @@ type ClientInterface interface {
 	UpdateReplicationController(api.ReplicationController) (api.ReplicationController, error)
 	DeleteReplicationController(string) error
 
-	// Service has not implemented yet...
+	WatchTasks(labelQuery map[string]string, stop <-chan bool) (<-chan TaskEvent, error)
+	WatchReplicationControllers(labelQuery map[string]string, stop <-chan bool) (<-chan ReplicationControllerEvent, error)
+
+	ListServices(labelQuery map[string]string) (api.ServiceList, error)
+	GetService(name string) (api.Service, error)
+	CreateService(api.Service) (api.Service, error)
+	UpdateService(api.Service) (api.Service, error)
+	DeleteService(string) error
 }
 
 // AuthInfo is used to store authorization information
@@ -66,15 +76,25 @@ type Client struct {
 	httpClient *http.Client
 }
 
-// Underlying base implementation of performing a request.
-// method is the HTTP method (e.g. "GET")
-// path is the path on the host to hit
-// requestBody is the body of the request. Can be nil.
-// target the interface to marshal the JSON response into.  Can be nil.
-func (client Client) rawRequest(method, path string, requestBody io.Reader, target interface{}) ([]byte, error) {
-	request, err := http.NewRequest(method, client.makeURL(path), requestBody)
+// TaskEvent is a single change to a task, as reported by WatchTasks.
+type TaskEvent struct {
+	Type watch.EventType
+	Task api.Task
+}
+
+// ReplicationControllerEvent is a single change to a replication controller, as reported
+// by WatchReplicationControllers.
+type ReplicationControllerEvent struct {
+	Type                  watch.EventType
+	ReplicationController api.ReplicationController
+}
+
+// Sends the request and returns the response, whose body must be closed by the caller.
+// ctx may be used to cancel long running requests, such as watches.
+func (client Client) doRequest(ctx context.Context, method, path string, requestBody io.Reader) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, client.makeURL(path), requestBody)
 	if err != nil {
-		return []byte{}, err
+		return nil, err
 	}
 	if client.Auth != nil {
 		request.SetBasicAuth(client.Auth.User, client.Auth.Password)
@@ -88,18 +108,27 @@ func (client Client) rawRequest(method, path string, requestBody io.Reader, targ
 	} else {
 		httpClient = &http.Client{Transport: tr}
 	}
-	response, err := httpClient.Do(request)
+	return httpClient.Do(request)
+}
+
+// Underlying base implementation of performing a request.
+// method is the HTTP method (e.g. "GET")
+// path is the path on the host to hit
+// requestBody is the body of the request. Can be nil.
+// target the interface to marshal the JSON response into.  Can be nil.
+func (client Client) rawRequest(method, path string, requestBody io.Reader, target interface{}) ([]byte, error) {
+	response, err := client.doRequest(context.Background(), method, path, requestBody)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("request [%s %s] failed (%d) %s", method, client.makeURL(path), response.StatusCode, response.Status)
-	}
 	defer response.Body.Close()
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
 		return body, err
 	}
+	if response.StatusCode != 200 {
+		return nil, decodeStatusError(method, client.makeURL(path), response, body)
+	}
 	if target != nil {
 		err = json.Unmarshal(body, target)
 	}
@@ -110,6 +139,72 @@ func (client Client) rawRequest(method, path string, requestBody io.Reader, targ
 	return body, err
 }
 
+// decodeStatusError turns a failed response into an error. If the server sent back an
+// api.Status it is returned as an *api.StatusError, so that callers can use helpers such
+// as api.IsNotFound on it.
+func decodeStatusError(method, url string, response *http.Response, body []byte) error {
+	var status api.Status
+	if err := json.Unmarshal(body, &status); err == nil && status.Status == api.StatusFailure {
+		if status.Code == 0 {
+			status.Code = response.StatusCode
+		}
+		return &api.StatusError{ErrStatus: status}
+	}
+	return fmt.Errorf("request [%s %s] failed (%d) %s", method, url, response.StatusCode, response.Status)
+}
+
+// rawWatch starts a watch on path, and calls decode for every event streamed by the
+// server until the server ends the stream or stop is closed.
+// decode returns false if the watch should end.
+// done is called once the watch has ended, unless rawWatch returns an error.
+func (client Client) rawWatch(path string, stop <-chan bool, decode func(eventType watch.EventType, object json.RawMessage) bool, done func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	response, err := client.doRequest(ctx, "GET", "watch/"+path, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if response.StatusCode != 200 {
+		defer cancel()
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		return decodeStatusError("GET", client.makeURL("watch/"+path), response, body)
+	}
+	go func() {
+		select {
+		case <-stop:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	go func() {
+		defer done()
+		defer util.HandleCrash()
+		defer cancel()
+		defer response.Body.Close()
+		decoder := json.NewDecoder(response.Body)
+		for {
+			var event struct {
+				Type   watch.EventType `json:"type"`
+				Object json.RawMessage `json:"object"`
+			}
+			if err := decoder.Decode(&event); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					log.Printf("Error decoding watch event: %v", err)
+				}
+				return
+			}
+			if !decode(event.Type, event.Object) {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
 func (client Client) makeURL(path string) string {
 	return client.Host + "/api/v1beta1/" + path
 }
@@ -150,6 +245,33 @@ func (client Client) ListTasks(labelQuery map[string]string) (api.TaskList, erro
 	return result, err
 }
 
+// WatchTasks takes a label query, and returns a channel of changes to the tasks that match that query.
+// The channel is closed when the watch ends, or after stop is closed.
+func (client Client) WatchTasks(labelQuery map[string]string, stop <-chan bool) (<-chan TaskEvent, error) {
+	path := "tasks"
+	if len(labelQuery) > 0 {
+		path += "?labels=" + EncodeLabelQuery(labelQuery)
+	}
+	result := make(chan TaskEvent)
+	err := client.rawWatch(path, stop, func(eventType watch.EventType, object json.RawMessage) bool {
+		event := TaskEvent{Type: eventType}
+		if err := json.Unmarshal(object, &event.Task); err != nil {
+			log.Printf("Failed to parse: %s\n", string(object))
+			return true
+		}
+		select {
+		case result <- event:
+			return true
+		case <-stop:
+			return false
+		}
+	}, func() { close(result) })
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // GetTask takes the name of the task, and returns the corresponding Task object, and an error if it occurs
 func (client Client) GetTask(name string) (api.Task, error) {
 	var result api.Task
@@ -214,3 +336,75 @@ func (client Client) DeleteReplicationController(name string) error {
 	_, err := client.rawRequest("DELETE", "replicationControllers/"+name, nil, nil)
 	return err
 }
+
+// ListServices takes a label query, and returns the list of services that match that query
+func (client Client) ListServices(labelQuery map[string]string) (api.ServiceList, error) {
+	path := "services"
+	if len(labelQuery) > 0 {
+		path += "?labels=" + EncodeLabelQuery(labelQuery)
+	}
+	var result api.ServiceList
+	_, err := client.rawRequest("GET", path, nil, &result)
+	return result, err
+}
+
+// GetService returns information about a particular service
+func (client Client) GetService(name string) (api.Service, error) {
+	var result api.Service
+	_, err := client.rawRequest("GET", "services/"+name, nil, &result)
+	return result, err
+}
+
+// CreateService creates a new service
+func (client Client) CreateService(svc api.Service) (api.Service, error) {
+	var result api.Service
+	body, err := json.Marshal(svc)
+	if err == nil {
+		_, err = client.rawRequest("POST", "services", bytes.NewBuffer(body), &result)
+	}
+	return result, err
+}
+
+// UpdateService updates an existing service
+func (client Client) UpdateService(svc api.Service) (api.Service, error) {
+	var result api.Service
+	body, err := json.Marshal(svc)
+	if err == nil {
+		_, err = client.rawRequest("PUT", "services/"+svc.ID, bytes.NewBuffer(body), &result)
+	}
+	return result, err
+}
+
+// DeleteService deletes an existing service
+func (client Client) DeleteService(name string) error {
+	_, err := client.rawRequest("DELETE", "services/"+name, nil, nil)
+	return err
+}
+
+// WatchReplicationControllers takes a label query, and returns a channel of changes to the
+// replication controllers that match that query.
+// The channel is closed when the watch ends, or after stop is closed.
+func (client Client) WatchReplicationControllers(labelQuery map[string]string, stop <-chan bool) (<-chan ReplicationControllerEvent, error) {
+	path := "replicationControllers"
+	if len(labelQuery) > 0 {
+		path += "?labels=" + EncodeLabelQuery(labelQuery)
+	}
+	result := make(chan ReplicationControllerEvent)
+	err := client.rawWatch(path, stop, func(eventType watch.EventType, object json.RawMessage) bool {
+		event := ReplicationControllerEvent{Type: eventType}
+		if err := json.Unmarshal(object, &event.ReplicationController); err != nil {
+			log.Printf("Failed to parse: %s\n", string(object))
+			return true
+		}
+		select {
+		case result <- event:
+			return true
+		case <-stop:
+			return false
+		}
+	}, func() { close(result) })
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -16,19 +16,43 @@ limitations under the License.
 package client
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
+// ContainerInfo knows how to get information about the containers of a task.
 type ContainerInfo interface {
+	// GetContainerInfo returns information about the containers of task 'name', which runs on 'host'.
 	GetContainerInfo(host, name string) (interface{}, error)
 }
 
+// HTTPContainerInfo gets container information from the info server of the kubelet on the task's host.
 type HTTPContainerInfo struct {
 	Client *http.Client
 	Port   uint
 }
 
 func (c *HTTPContainerInfo) GetContainerInfo(host, name string) (interface{}, error) {
-	// not implemented
-	return nil, nil
+	infoURL := fmt.Sprintf("http://%s/manifestInfo?manifest=%s",
+		net.JoinHostPort(host, strconv.FormatUint(uint64(c.Port), 10)), url.QueryEscape(name))
+	response, err := c.Client.Get(infoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request [GET %s] failed (%d) %s", infoURL, response.StatusCode, string(body))
+	}
+	var info interface{}
+	err = json.Unmarshal(body, &info)
+	return info, err
 }
@@ -0,0 +1,333 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+// Interface for testability
+type DockerInterface interface {
+	ListContainers(options docker.ListContainersOptions) ([]docker.APIContainers, error)
+	InspectContainer(id string) (*docker.Container, error)
+	CreateContainer(docker.CreateContainerOptions) (*docker.Container, error)
+	StartContainer(id string, hostConfig *docker.HostConfig) error
+	StopContainer(id string, timeout uint) error
+	RemoveContainer(opts docker.RemoveContainerOptions) error
+	PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error
+	InspectImage(name string) (*docker.Image, error)
+	CreateExec(opts docker.CreateExecOptions) (*docker.Exec, error)
+	StartExec(id string, opts docker.StartExecOptions) error
+	InspectExec(id string) (*docker.ExecInspect, error)
+}
+
+// The registry images without a registry host are pulled from.
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// DockerRuntime is a ContainerRuntime which runs containers with a Docker daemon.
+type DockerRuntime struct {
+	client DockerInterface
+	// Registry credentials, may be nil.
+	auth *docker.AuthConfigurations
+	// Guards pullLocks.
+	lock sync.Mutex
+	// Serializes pulls of the same image, keyed by image.
+	pullLocks map[string]*sync.Mutex
+}
+
+// MakeDockerRuntime makes a ContainerRuntime talking to docker through client. Images are
+// pulled with the credentials for their registry in auth, which may be nil.
+func MakeDockerRuntime(client DockerInterface, auth *docker.AuthConfigurations) *DockerRuntime {
+	return &DockerRuntime{
+		client:    client,
+		auth:      auth,
+		pullLocks: map[string]*sync.Mutex{},
+	}
+}
+
+func (d *DockerRuntime) pullLock(image string) *sync.Mutex {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	lock, ok := d.pullLocks[image]
+	if !ok {
+		lock = &sync.Mutex{}
+		d.pullLocks[image] = lock
+	}
+	return lock
+}
+
+func (d *DockerRuntime) PullImage(image string) error {
+	lock := d.pullLock(image)
+	lock.Lock()
+	defer lock.Unlock()
+	repository, tag := parseImageName(image)
+	opts := docker.PullImageOptions{
+		Repository: repository,
+		Tag:        tag,
+	}
+	return d.client.PullImage(opts, d.registryAuth(repository))
+}
+
+func (d *DockerRuntime) IsImagePresent(image string) (bool, error) {
+	_, err := d.client.InspectImage(image)
+	if err == docker.ErrNoSuchImage {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Returns the credentials for the registry repository is hosted on, if there are any.
+func (d *DockerRuntime) registryAuth(repository string) docker.AuthConfiguration {
+	if d.auth == nil {
+		return docker.AuthConfiguration{}
+	}
+	registry := dockerHubRegistry
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		registry = parts[0]
+	}
+	for address, auth := range d.auth.Configs {
+		if address == registry || registryHost(address) == registryHost(registry) {
+			return auth
+		}
+	}
+	return docker.AuthConfiguration{}
+}
+
+// Strips the scheme and path of a registry address, as they are optional in dockercfg files.
+func registryHost(address string) string {
+	address = strings.TrimPrefix(address, "https://")
+	address = strings.TrimPrefix(address, "http://")
+	return strings.SplitN(address, "/", 2)[0]
+}
+
+// Splits an image into the repository and the tag or digest to pull.
+func parseImageName(image string) (repository, tag string) {
+	if parts := strings.SplitN(image, "@", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	repository, tag = docker.ParseRepositoryTag(image)
+	if len(tag) == 0 {
+		tag = "latest"
+	}
+	return repository, tag
+}
+
+func (d *DockerRuntime) CreateContainer(manifest *api.ContainerManifest, container *api.Container, opts ContainerOptions) (string, error) {
+	envVariables := []string{}
+	for _, value := range container.Env {
+		envVariables = append(envVariables, fmt.Sprintf("%s=%s", value.Name, value.Value))
+	}
+
+	volumes := map[string]struct{}{}
+	binds := []string{}
+	for _, volume := range container.VolumeMounts {
+		hostPath, ok := opts.VolumePaths[volume.Name]
+		if !ok {
+			return "", fmt.Errorf("container %s mounts unknown volume %s", container.Name, volume.Name)
+		}
+		volumes[volume.MountPath] = struct{}{}
+		basePath := hostPath + ":" + volume.MountPath
+		if volume.ReadOnly {
+			basePath += ":ro"
+		}
+		binds = append(binds, basePath)
+	}
+
+	exposedPorts := map[docker.Port]struct{}{}
+	portBindings := map[docker.Port][]docker.PortBinding{}
+	networkMode := ""
+	ports := container.Ports
+	if len(opts.NetworkContainerID) > 0 {
+		// The network container publishes the ports.
+		networkMode = "container:" + opts.NetworkContainerID
+		ports = nil
+	}
+	for _, port := range ports {
+		interiorPort := port.ContainerPort
+		exteriorPort := port.HostPort
+		protocol, err := dockerProtocol(port.Protocol)
+		if err != nil {
+			return "", err
+		}
+		// Some of this port stuff is under-documented voodoo.
+		// See http://stackoverflow.com/questions/20428302/binding-a-port-to-a-host-interface-using-the-rest-api
+		dockerPort := docker.Port(strconv.Itoa(interiorPort) + "/" + protocol)
+		exposedPorts[dockerPort] = struct{}{}
+		if exteriorPort == 0 {
+			continue
+		}
+		portBindings[dockerPort] = append(portBindings[dockerPort], docker.PortBinding{
+			HostIP:   port.HostIP,
+			HostPort: strconv.Itoa(exteriorPort),
+		})
+	}
+	createOpts := docker.CreateContainerOptions{
+		Name: opts.Name,
+		Config: &docker.Config{
+			Image:        container.Image,
+			ExposedPorts: exposedPorts,
+			Env:          envVariables,
+			Volumes:      volumes,
+			WorkingDir:   container.WorkingDir,
+			Entrypoint:   container.Command,
+			Cmd:          container.Args,
+		},
+		HostConfig: &docker.HostConfig{
+			PortBindings: portBindings,
+			Binds:        binds,
+			NetworkMode:  networkMode,
+			Memory:       int64(container.Memory),
+			CPUShares:    milliCPUToShares(container.CPU),
+		},
+	}
+	dockerContainer, err := d.client.CreateContainer(createOpts)
+	if err != nil {
+		return "", err
+	}
+	return dockerContainer.ID, nil
+}
+
+// Converts the protocol of an api.Port into the one docker uses in port names.
+func dockerProtocol(protocol string) (string, error) {
+	switch strings.ToUpper(protocol) {
+	case "", api.ProtocolTCP:
+		return "tcp", nil
+	case api.ProtocolUDP:
+		return "udp", nil
+	default:
+		return "", fmt.Errorf("unknown port protocol %q", protocol)
+	}
+}
+
+// Docker gives a container 1024 CPU shares by default, which we take to be one core.
+const sharesPerCPU = 1024
+
+// Converts thousandths of a core into docker CPU shares. 0 keeps docker's default.
+func milliCPUToShares(milliCPU int) int64 {
+	if milliCPU <= 0 {
+		return 0
+	}
+	shares := int64(milliCPU) * sharesPerCPU / 1000
+	// Docker's minimum number of shares.
+	if shares < 2 {
+		shares = 2
+	}
+	return shares
+}
+
+func (d *DockerRuntime) StartContainer(id string) error {
+	// The host config was given when the container was created.
+	return d.client.StartContainer(id, nil)
+}
+
+func (d *DockerRuntime) StopContainer(id string, timeout time.Duration) error {
+	return d.client.StopContainer(id, uint(timeout/time.Second))
+}
+
+func (d *DockerRuntime) RemoveContainer(id string) error {
+	return d.client.RemoveContainer(docker.RemoveContainerOptions{ID: id, RemoveVolumes: true})
+}
+
+func (d *DockerRuntime) ListContainers(all bool) ([]RuntimeContainer, error) {
+	dockerContainers, err := d.client.ListContainers(docker.ListContainersOptions{All: all})
+	if err != nil {
+		return nil, err
+	}
+	result := []RuntimeContainer{}
+	for _, dockerContainer := range dockerContainers {
+		if len(dockerContainer.Names) == 0 {
+			continue
+		}
+		result = append(result, RuntimeContainer{
+			ID: dockerContainer.ID,
+			// For some reason, docker gives back names that start with '/'
+			Name:    strings.TrimPrefix(dockerContainer.Names[0], "/"),
+			Created: time.Unix(dockerContainer.Created, 0),
+		})
+	}
+	return result, nil
+}
+
+func (d *DockerRuntime) InspectContainer(id string) (*RuntimeContainerInfo, error) {
+	inspect, err := d.client.InspectContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	info := &RuntimeContainerInfo{
+		ID:   inspect.ID,
+		Name: strings.TrimPrefix(inspect.Name, "/"),
+		Info: inspect,
+	}
+	if inspect.NetworkSettings != nil {
+		info.IP = inspect.NetworkSettings.IPAddress
+	}
+	// Containers sharing the network of another container have no address of their own.
+	if inspect.HostConfig != nil && strings.HasPrefix(inspect.HostConfig.NetworkMode, "container:") {
+		network, err := d.client.InspectContainer(strings.TrimPrefix(inspect.HostConfig.NetworkMode, "container:"))
+		if err == nil && network.NetworkSettings != nil {
+			info.IP = network.NetworkSettings.IPAddress
+		}
+	}
+	switch {
+	case inspect.State.Running:
+		info.State.Running = &api.ContainerStateRunning{StartedAt: inspect.State.StartedAt}
+	case !inspect.State.FinishedAt.IsZero():
+		info.State.Terminated = &api.ContainerStateTerminated{
+			ExitCode:   inspect.State.ExitCode,
+			Reason:     inspect.State.Error,
+			StartedAt:  inspect.State.StartedAt,
+			FinishedAt: inspect.State.FinishedAt,
+		}
+	default:
+		info.State.Waiting = &api.ContainerStateWaiting{Reason: "not started"}
+	}
+	return info, nil
+}
+
+func (d *DockerRuntime) ExecInContainer(id string, cmd []string) (int, error) {
+	exec, err := d.client.CreateExec(docker.CreateExecOptions{
+		Container:    id,
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Waits for the command to exit.
+	err = d.client.StartExec(exec.ID, docker.StartExecOptions{
+		OutputStream: io.Discard,
+		ErrorStream:  io.Discard,
+	})
+	if err != nil {
+		return 0, err
+	}
+	inspect, err := d.client.InspectExec(exec.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
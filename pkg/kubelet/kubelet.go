@@ -20,15 +20,20 @@ package kubelet
 import (
 	"encoding/json"
 	"fmt"
+	"hash/adler32"
+	"io"
 	"log"
 	"math/rand"
-	"os/exec"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	docker "github.com/fsouza/go-dockerclient"
 	"github.com/goccy/go-yaml"
 	"github.com/kawabatas/toy-k8s/pkg/api"
 	"github.com/kawabatas/toy-k8s/pkg/registry"
@@ -36,42 +41,213 @@ import (
 	"github.com/kawabatas/toy-k8s/third_party/github.com/coreos/go-etcd/etcd"
 )
 
-// State, sub object of the Docker JSON data
-type State struct {
-	Running bool
-}
-
-// Interface for testability
-type DockerInterface interface {
-	ListContainers(options docker.ListContainersOptions) ([]docker.APIContainers, error)
-	InspectContainer(id string) (*docker.Container, error)
-	CreateContainer(docker.CreateContainerOptions) (*docker.Container, error)
-	StartContainer(id string, hostConfig *docker.HostConfig) error
-	StopContainer(id string, timeout uint) error
-}
+const (
+	// How often the kubelet refreshes its minion registration.
+	minionHeartbeatPeriod = 10 * time.Second
+)
 
 // The main kubelet implementation
 type Kubelet struct {
 	Client             registry.EtcdClient
-	DockerClient       DockerInterface
+	Runtime            ContainerRuntime
 	FileCheckFrequency time.Duration
 	SyncFrequency      time.Duration
 	HTTPCheckFrequency time.Duration
-	pullLock           sync.Mutex
 	Hostname           string
+	// The directory the kubelet keeps task data, such as emptyDir volumes, in.
+	RootDirectory string
+	// The image of the container holding the network of each task, which all the task's
+	// containers share. If empty, each container gets its own network.
+	NetworkContainerImage string
+	// The resources of this machine available to tasks, reported to the scheduler. See
+	// api.Minion.
+	MemoryCapacity int
+	CPUCapacity    int
+	// The last status reported for each manifest, keyed by manifest id.
+	reportedStatus map[string]string
+	// The number of liveness probes in a row which failed, keyed by container id.
+	livenessFailures map[string]int
+	// The restarts of each container of a manifest, keyed by restartKey.
+	restarts map[string]*restartState
+	// Has every configuration source of RunSyncLoop delivered a configuration? Until then,
+	// manifests missing from the merged configuration may just not have been seen yet.
+	sourcesReady bool
 }
 
 // Starts background goroutines. If file, manifest_url, or address are empty,
 // they are not watched. Never returns.
 func (sl *Kubelet) RunKubelet(file, manifest_url, etcd_servers, address string, port uint) {
-	etcdChannel := make(chan []api.ContainerManifest)
+	if len(address) > 0 {
+		go util.Forever(func() { sl.RunServer(address, port) }, 5*time.Second)
+	}
+
+	sources := map[string]<-chan []api.ContainerManifest{}
+
+	if len(file) > 0 {
+		fileChannel := make(chan []api.ContainerManifest)
+		sources[FileSource] = fileChannel
+		go util.Forever(func() { sl.WatchFile(file, fileChannel) }, sl.FileCheckFrequency)
+	}
+
+	if len(manifest_url) > 0 {
+		urlChannel := make(chan []api.ContainerManifest)
+		sources[HTTPSource] = urlChannel
+		go util.Forever(func() { sl.WatchHTTP(manifest_url, urlChannel) }, sl.HTTPCheckFrequency)
+	}
+
+	if len(etcd_servers) > 0 {
+		etcdChannel := make(chan []api.ContainerManifest)
+		sources[EtcdSource] = etcdChannel
+		servers := []string{etcd_servers}
+		log.Printf("Creating etcd client pointing to %v", servers)
+		sl.Client = etcd.NewClient(servers)
+		go util.Forever(func() { sl.SyncAndSetupEtcdWatch(etcdChannel) }, 20*time.Second)
+		go util.Forever(func() {
+			if err := sl.RegisterMinion(address); err != nil {
+				log.Printf("Error registering minion: %v", err)
+			}
+		}, minionHeartbeatPeriod)
+	}
 
-	servers := []string{etcd_servers}
-	log.Printf("Creating etcd client pointing to %v", servers)
-	sl.Client = etcd.NewClient(servers)
-	go util.Forever(func() { sl.SyncAndSetupEtcdWatch(etcdChannel) }, 20*time.Second)
+	sl.RunSyncLoop(sources, sl)
+}
 
-	sl.RunSyncLoop(etcdChannel, sl)
+// Read the manifests in file, and send them across changeChannel. file is either a
+// single manifest (YAML or JSON), or a directory of them. Manifests without an id are
+// named after their file. Nothing is sent if file can't be read, so the last good
+// configuration stays in place.
+func (sl *Kubelet) WatchFile(file string, changeChannel chan<- []api.ContainerManifest) {
+	manifests, err := sl.extractFromFile(file)
+	if err != nil {
+		log.Printf("Couldn't read config file %s: %v", file, err)
+		return
+	}
+	changeChannel <- manifests
+}
+
+func (sl *Kubelet) extractFromFile(file string) ([]api.ContainerManifest, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		manifest, err := sl.extractManifestFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return []api.ContainerManifest{manifest}, nil
+	}
+	entries, err := os.ReadDir(file)
+	if err != nil {
+		return nil, err
+	}
+	manifests := []api.ContainerManifest{}
+	// ReadDir sorts by file name, so the order of manifests is stable.
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		manifest, err := sl.extractManifestFromFile(filepath.Join(file, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+func (sl *Kubelet) extractManifestFromFile(file string) (api.ContainerManifest, error) {
+	var manifest api.ContainerManifest
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return manifest, err
+	}
+	if err := sl.ExtractYAMLData(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(manifest.Id) == 0 {
+		manifest.Id = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	return manifest, nil
+}
+
+// Fetch the manifests served at url, and send them across changeChannel. The response
+// is either a single manifest or a list of them. Nothing is sent if the fetch fails, so
+// the last good configuration stays in place.
+func (sl *Kubelet) WatchHTTP(url string, changeChannel chan<- []api.ContainerManifest) {
+	manifests, err := sl.extractFromHTTP(url)
+	if err != nil {
+		log.Printf("Couldn't read manifests from %s: %v", url, err)
+		return
+	}
+	changeChannel <- manifests
+}
+
+func (sl *Kubelet) extractFromHTTP(url string) ([]api.ContainerManifest, error) {
+	client := &http.Client{Timeout: sl.HTTPCheckFrequency}
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return []api.ContainerManifest{}, nil
+	}
+	var manifests []api.ContainerManifest
+	var manifest api.ContainerManifest
+	singleErr := yaml.Unmarshal(data, &manifest)
+	if singleErr == nil {
+		manifests = []api.ContainerManifest{manifest}
+	} else if err := yaml.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("not a manifest (%v) or a list of manifests (%v)", singleErr, err)
+	}
+	// Unlike a file, a URL can serve several manifests, so there's no name to default ids to.
+	for ix := range manifests {
+		if len(manifests[ix].Id) == 0 {
+			return nil, fmt.Errorf("manifest %d has no id", ix)
+		}
+	}
+	return manifests, nil
+}
+
+// Serve container information over HTTP, see KubeletServer.
+func (sl *Kubelet) RunServer(address string, port uint) {
+	s := &http.Server{
+		Addr:           net.JoinHostPort(address, strconv.FormatUint(uint64(port), 10)),
+		Handler:        &KubeletServer{Kubelet: sl},
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+	log.Printf("Serving container info on %s", s.Addr)
+	log.Printf("Info server stopped: %v", s.ListenAndServe())
+}
+
+// Register this machine as a minion that tasks can be scheduled onto, recording now as its
+// last heartbeat. The MinionController marks the minion NotReady once this hasn't been called
+// for a while, and the registration expires after registry.MinionTTL.
+func (sl *Kubelet) RegisterMinion(address string) error {
+	hostname := strings.TrimSpace(sl.Hostname)
+	data, err := json.Marshal(api.Minion{
+		JSONBase:       api.JSONBase{ID: hostname},
+		HostIP:         address,
+		Status:         api.MinionReady,
+		LastHeartbeat:  time.Now().Unix(),
+		MemoryCapacity: sl.MemoryCapacity,
+		CPUCapacity:    sl.CPUCapacity,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = sl.Client.Set(registry.MakeMinionKey(hostname), string(data), uint64(registry.MinionTTL.Seconds()))
+	return err
 }
 
 // Sync with etcd, and set up an etcd watch for new configurations
@@ -102,7 +278,8 @@ func (sl *Kubelet) SyncAndSetupEtcdWatch(changeChannel chan<- []api.ContainerMan
 
 		sl.getKubeletStateFromEtcd(key, changeChannel)
 		log.Printf("Setting up a watch for configuration changes in etcd for %s", key)
-		sl.Client.Watch(key, 0, true, watchChannel, done)
+		// Only watch the manifest list, the kubelet writes task status under key itself.
+		sl.Client.Watch(key+"/kubelet", 0, false, watchChannel, done)
 	}
 }
 
@@ -114,6 +291,8 @@ func (sl *Kubelet) getKubeletStateFromEtcd(key string, changeChannel chan<- []ap
 		case *etcd.EtcdError:
 			etcdError := err.(*etcd.EtcdError)
 			if etcdError.ErrorCode == 100 {
+				// Nothing has been scheduled onto this host yet.
+				changeChannel <- []api.ContainerManifest{}
 				return nil
 			}
 		}
@@ -188,41 +367,117 @@ func (sl *Kubelet) WatchEtcd(watchChannel <-chan *etcd.Response, changeChannel c
 	}
 }
 
+// Names of the configuration sources the kubelet reads manifests from.
+const (
+	EtcdSource = "etcd"
+	FileSource = "file"
+	HTTPSource = "http"
+)
+
 // Interface implemented by Kubelet, for testability
 type SyncHandler interface {
-	SyncManifests([]api.ContainerManifest) error
+	// sources maps the id of each manifest in config to the source it came from.
+	SyncManifests(config []api.ContainerManifest, sources map[string]string) error
+}
+
+// The latest manifests from a single configuration source.
+type manifestUpdate struct {
+	source    string
+	manifests []api.ContainerManifest
 }
 
 // runSyncLoop is the main loop for processing changes. It watches for changes from
-// four channels (file, etcd, server, and http) and creates a union of the two. For
-// any new change seen, will run a sync against desired state and running state. If
-// no changes are seen to the configuration, will synchronize the last known desired
-// state every sync_frequency seconds.
+// each named source channel and keeps the latest configuration of each one separately,
+// merging them on every sync. For any new change seen, will run a sync against desired
+// state and running state. If no changes are seen to the configuration, will synchronize
+// the last known desired state every sync_frequency seconds.
 // Never returns.
-func (sl *Kubelet) RunSyncLoop(etcdChannel <-chan []api.ContainerManifest, handler SyncHandler) {
-	var lastEtcd []api.ContainerManifest
+func (sl *Kubelet) RunSyncLoop(sources map[string]<-chan []api.ContainerManifest, handler SyncHandler) {
+	updates := make(chan manifestUpdate)
+	for source, channel := range sources {
+		go func(source string, channel <-chan []api.ContainerManifest) {
+			defer util.HandleCrash()
+			for manifests := range channel {
+				updates <- manifestUpdate{source, manifests}
+			}
+		}(source, channel)
+	}
+
+	last := map[string][]api.ContainerManifest{}
 	for {
 		select {
-		case manifests := <-etcdChannel:
-			log.Printf("Got new configuration from etcd... %v", manifests)
-			lastEtcd = manifests
+		case update := <-updates:
+			log.Printf("Got new configuration from %s... %v", update.source, update.manifests)
+			last[update.source] = update.manifests
 		case <-time.After(sl.SyncFrequency):
 		}
 
-		manifests := append([]api.ContainerManifest{}, lastEtcd...)
-		err := handler.SyncManifests(manifests)
+		manifests, provenance := mergeManifests(last)
+		sl.sourcesReady = len(last) == len(sources)
+		err := handler.SyncManifests(manifests, provenance)
 		if err != nil {
 			log.Printf("Couldn't sync containers : %#v", err)
 		}
 	}
 }
 
+// Merge the manifests of each source into one desired set, and record which source each
+// manifest came from. Sources are merged in name order; a manifest whose id was already
+// seen is reported and dropped, since its containers would collide with the first one.
+func mergeManifests(sources map[string][]api.ContainerManifest) ([]api.ContainerManifest, map[string]string) {
+	names := []string{}
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifests := []api.ContainerManifest{}
+	provenance := map[string]string{}
+	for _, name := range names {
+		for _, manifest := range sources[name] {
+			if source, found := provenance[manifest.Id]; found {
+				log.Printf("Duplicate manifest %q from %s, already provided by %s; ignoring it", manifest.Id, name, source)
+				continue
+			}
+			provenance[manifest.Id] = name
+			manifests = append(manifests, manifest)
+		}
+	}
+	return manifests, provenance
+}
+
 // Sync the configured list of containers (desired state) with the host current state
-func (sl *Kubelet) SyncManifests(config []api.ContainerManifest) error {
-	log.Printf("Desired: %#v", config)
-	var err error
+func (sl *Kubelet) SyncManifests(config []api.ContainerManifest, sources map[string]string) error {
+	log.Printf("Desired: %#v from %v", config, sources)
+	allContainers, err := sl.Runtime.ListContainers(true)
+	if err != nil {
+		return err
+	}
+	toStart, err := sl.containersToStart(config, allContainers)
+	if err != nil {
+		return err
+	}
+	pulls := sl.pullImages(toStart)
 	desired := map[string]bool{}
 	for _, manifest := range config {
+		networkID, networkCreated := "", false
+		if len(sl.NetworkContainerImage) > 0 {
+			networkName, id, created, err := sl.syncNetworkContainer(&manifest, allContainers, pulls)
+			if err != nil {
+				log.Printf("Error running the network container of %s: %v skipping.", manifest.Id, err)
+				// Leave the other containers which are still running alone, they are moved
+				// into the network of the next holder once it runs.
+				for _, container := range allContainers {
+					manifestId, containerName, _ := dockerNameToManifestAndContainer(container.Name)
+					if manifestId == manifest.Id && containerName != networkContainerName {
+						desired[container.Name] = true
+					}
+				}
+				continue
+			}
+			desired[networkName] = true
+			networkID, networkCreated = id, created
+		}
 		for _, element := range manifest.Containers {
 			var exists bool
 			exists, actualName, err := sl.ContainerExists(&manifest, &element)
@@ -230,38 +485,205 @@ func (sl *Kubelet) SyncManifests(config []api.ContainerManifest) error {
 				log.Printf("Error detecting container: %#v skipping.", err)
 				continue
 			}
-			if !exists {
+			if exists && networkCreated {
+				log.Printf("Moving %s into the new network container of %s", actualName, manifest.Id)
+				if killErr := sl.KillContainer(actualName); killErr != nil {
+					log.Printf("Error killing container: %#v", killErr)
+				}
+				actualName, err = sl.RunContainer(&manifest, &element, networkID, pulls)
+				if err != nil {
+					log.Printf("Error creating container: %#v, %s", err, err.Error())
+					continue
+				}
+			} else if !exists {
+				if start, reason := sl.canStartContainer(&manifest, &element, allContainers); !start {
+					log.Printf("Not starting %s of %s: %s", element.Name, manifest.Id, reason)
+					continue
+				}
 				log.Printf("Doesn't exist, creating... %#v", element)
-				actualName, err = sl.RunContainer(&manifest, &element)
-				// For some reason, list gives back names that start with '/'
-				actualName = "/" + actualName
-
+				actualName, err = sl.RunContainer(&manifest, &element, networkID, pulls)
 				if err != nil {
 					// TODO(bburns) : Perhaps blacklist a container after N failures?
 					log.Printf("Error creating container: %#v, %s", err, err.Error())
 					desired[actualName] = true
 					continue
 				}
+				sl.recordStart(&manifest, &element, allContainers)
 			} else {
 				log.Printf("%#v exists as %v", element.Name, actualName)
+				if !sl.checkLiveness(&element, actualName) {
+					sl.LogEvent(&api.Event{
+						Event:     "UNHEALTHY",
+						Manifest:  &api.ContainerManifest{Id: manifest.Id},
+						Container: &element,
+					})
+					// Its restart policy decides when it is started again.
+					if killErr := sl.KillContainer(actualName); killErr != nil {
+						log.Printf("Error killing unhealthy container: %#v", killErr)
+					}
+					continue
+				}
 			}
 			desired[actualName] = true
 		}
 	}
-	existingContainers, _ := sl.ListContainers()
-	log.Printf("Existing: %#v \n Desired: %#v", existingContainers, desired)
-	for _, container := range existingContainers {
-		if !desired[container] {
-			log.Printf("Killing: %s", container)
-			err = sl.KillContainer(container)
-			if err != nil {
-				log.Printf("Error killing container: %#v", err)
+	// Until every source has reported, a container missing from config may belong to a
+	// manifest of a source which hasn't been heard from yet.
+	if sl.sourcesReady {
+		existingContainers, _ := sl.ListContainers()
+		log.Printf("Existing: %#v \n Desired: %#v", existingContainers, desired)
+		for _, container := range existingContainers {
+			if !desired[container] {
+				log.Printf("Killing: %s", container)
+				err = sl.KillContainer(container)
+				if err != nil {
+					log.Printf("Error killing container: %#v", err)
+				}
 			}
 		}
+		if removeErr := sl.removeDeadContainers(config); removeErr != nil {
+			log.Printf("Error removing exited containers: %#v", removeErr)
+		}
+	}
+	if cleanupErr := sl.cleanupTaskDirectories(config); cleanupErr != nil {
+		log.Printf("Error deleting task directories: %#v", cleanupErr)
+	}
+	if sl.Client == nil {
+		return err
+	}
+	// Only tasks scheduled through etcd are known to the apiserver.
+	scheduled := []api.ContainerManifest{}
+	for _, manifest := range config {
+		if sources[manifest.Id] == EtcdSource {
+			scheduled = append(scheduled, manifest)
+		}
+	}
+	if reportErr := sl.ReportTaskStatus(scheduled); reportErr != nil {
+		log.Printf("Error reporting task status: %#v", reportErr)
 	}
 	return err
 }
 
+// Write the status of every manifest in config to etcd, so that the apiserver can report
+// it as the current state of the task. Only statuses which changed since the last call, or
+// which were deleted since, are written.
+func (sl *Kubelet) ReportTaskStatus(config []api.ContainerManifest) error {
+	if sl.Client == nil {
+		return fmt.Errorf("no etcd client connection")
+	}
+	if sl.reportedStatus == nil {
+		sl.reportedStatus = map[string]string{}
+	}
+	hostname := strings.TrimSpace(sl.Hostname)
+	containers, err := sl.Runtime.ListContainers(true)
+	if err != nil {
+		return err
+	}
+	var resultErr error
+	current := map[string]bool{}
+	for ix := range config {
+		manifest := &config[ix]
+		if len(manifest.Id) == 0 {
+			continue
+		}
+		current[manifest.Id] = true
+		data := util.MakeJSONString(sl.GetTaskStatus(manifest, containers))
+		key := registry.MakeTaskStatusKey(hostname, manifest.Id)
+		if sl.reportedStatus[manifest.Id] == data {
+			// The apiserver deletes the status along with the task, and the task may have
+			// been recreated since, so write the status again if it is gone.
+			_, err := sl.Client.Create(key, data, 0)
+			if err == nil {
+				log.Printf("Status of %s was deleted, reported it again", manifest.Id)
+			} else if etcdError, ok := err.(*etcd.EtcdError); !ok || etcdError.ErrorCode != 105 {
+				resultErr = err
+			}
+			continue
+		}
+		if _, err := sl.Client.Set(key, data, 0); err != nil {
+			resultErr = err
+			continue
+		}
+		sl.reportedStatus[manifest.Id] = data
+	}
+	for id := range sl.reportedStatus {
+		if current[id] {
+			continue
+		}
+		delete(sl.reportedStatus, id)
+		if _, err := sl.Client.Delete(registry.MakeTaskStatusKey(hostname, id), false); err != nil {
+			log.Printf("Error deleting status of %s: %v", id, err)
+		}
+	}
+	return resultErr
+}
+
+// Compute the status of manifest from the containers on this host.
+func (sl *Kubelet) GetTaskStatus(manifest *api.ContainerManifest, containers []RuntimeContainer) api.TaskState {
+	result := api.TaskState{
+		ContainerStatuses: map[string]api.ContainerStatus{},
+	}
+	waiting, running, terminated := 0, 0, 0
+	result.Ready = true
+	for ix := range manifest.Containers {
+		container := &manifest.Containers[ix]
+		status := sl.getContainerStatus(manifest, container, containers)
+		switch {
+		case status.State.Running != nil:
+			running++
+		case status.State.Terminated != nil:
+			terminated++
+		default:
+			waiting++
+		}
+		result.ContainerStatuses[container.Name] = status
+		result.Ready = result.Ready && status.Ready
+	}
+	switch {
+	case waiting > 0:
+		result.Status = api.TaskWaiting
+	case running > 0:
+		result.Status = api.TaskRunning
+	case terminated > 0:
+		result.Status = api.TaskTerminated
+	default:
+		result.Status = api.TaskWaiting
+	}
+	return result
+}
+
+// Find the most recently created runtime container for container, and describe its state.
+// A container which exited and is going to be restarted is reported as waiting.
+func (sl *Kubelet) getContainerStatus(manifest *api.ContainerManifest, container *api.Container, containers []RuntimeContainer) api.ContainerStatus {
+	history := containerHistory(manifest, container, containers)
+	if len(history) == 0 {
+		return api.ContainerStatus{
+			State: api.ContainerState{Waiting: &api.ContainerStateWaiting{Reason: "not created"}},
+		}
+	}
+	latest := history[0]
+	status := api.ContainerStatus{
+		ContainerID:  latest.ID,
+		RestartCount: sl.restartStateOf(manifest, container, history).count,
+	}
+	info, err := sl.Runtime.InspectContainer(latest.ID)
+	if err != nil {
+		log.Printf("Error inspecting container %s: %v", latest.ID, err)
+		status.State.Waiting = &api.ContainerStateWaiting{Reason: err.Error()}
+		return status
+	}
+	status.State = info.State
+	if info.State.Running != nil {
+		status.Ready = sl.checkReadiness(container, info)
+	}
+	if terminated := info.State.Terminated; terminated != nil && shouldRestart(manifest, terminated) {
+		status.State = api.ContainerState{Waiting: &api.ContainerStateWaiting{
+			Reason: fmt.Sprintf("restarting, exited with code %d", terminated.ExitCode),
+		}}
+	}
+	return status
+}
+
 // Does this container exist on this host? Returns true if so, and the name under which the container is running.
 // Returns an error if one occurs.
 func (sl *Kubelet) ContainerExists(manifest *api.ContainerManifest, container *api.Container) (exists bool, foundName string, err error) {
@@ -270,32 +692,33 @@ func (sl *Kubelet) ContainerExists(manifest *api.ContainerManifest, container *a
 		return false, "", err
 	}
 	for _, name := range containers {
-		manifestId, containerName := dockerNameToManifestAndContainer(name)
-		if manifestId == manifest.Id && containerName == container.Name {
-			// TODO(bburns) : This leads to an extra list.  Convert this to use the returned ID and a straight call
-			// to inspect
-			data, err := sl.GetContainerByName(name)
-			return data != nil, name, err
+		manifestId, containerName, hash := dockerNameToManifestAndContainer(name)
+		// A container whose spec has changed (e.g. by a task update) doesn't count, it is
+		// replaced by a new one.
+		if manifestId == manifest.Id && containerName == container.Name && hash == hashContainer(container) {
+			return true, name, nil
 		}
 	}
 	return false, "", nil
 }
 
+// Returns the names of the running containers.
 func (sl *Kubelet) ListContainers() ([]string, error) {
 	result := []string{}
-	containerList, err := sl.DockerClient.ListContainers(docker.ListContainersOptions{})
+	containerList, err := sl.Runtime.ListContainers(false)
 	if err != nil {
 		return result, err
 	}
 	for _, value := range containerList {
-		result = append(result, value.Names[0])
+		result = append(result, value.Name)
 	}
 	return result, err
 }
 
-// Upacks a container name, returning the manifest id and container name we would have used to
-// construct the docker name. If the docker name isn't one we created, we may return empty strings.
-func dockerNameToManifestAndContainer(name string) (manifestId, containerName string) {
+// Upacks a container name, returning the manifest id, container name and container hash we would
+// have used to construct the docker name. If the docker name isn't one we created, we may return
+// empty strings.
+func dockerNameToManifestAndContainer(name string) (manifestId, containerName, hash string) {
 	// For some reason docker appears to be appending '/' to names.
 	// If its there, strip it.
 	if name[0] == '/' {
@@ -308,9 +731,18 @@ func dockerNameToManifestAndContainer(name string) (manifestId, containerName st
 	if len(parts) > 1 {
 		manifestId = unescapeDash(parts[1])
 	}
+	if len(parts) > 3 {
+		hash = parts[2]
+	}
 	return
 }
 
+// Is name a container name made by manifestAndContainerToDockerName? Other containers on
+// the host are left alone.
+func isKubeletContainerName(name string) bool {
+	return len(strings.Split(strings.TrimPrefix(name, "/"), "--")) == 4
+}
+
 // Reverses the transformation of escapeDash.
 func unescapeDash(in string) (out string) {
 	out = strings.Replace(in, "_-_", "-", -1)
@@ -318,107 +750,160 @@ func unescapeDash(in string) (out string) {
 	return
 }
 
-// Get a container by name.
-// returns the container data from Docker, or an error if one exists.
-func (sl *Kubelet) GetContainerByName(name string) (*docker.Container, error) {
-	id, err := sl.GetContainerID(name)
-	if err != nil {
-		return nil, err
-	}
-	return sl.DockerClient.InspectContainer(id)
-}
-
 func (sl *Kubelet) GetContainerID(name string) (string, error) {
-	containerList, err := sl.DockerClient.ListContainers(docker.ListContainersOptions{})
+	containerList, err := sl.Runtime.ListContainers(false)
 	if err != nil {
 		return "", err
 	}
 	for _, value := range containerList {
-		if strings.Contains(value.Names[0], name) {
+		if value.Name == name {
 			return value.ID, nil
 		}
 	}
 	return "", fmt.Errorf("couldn't find name: %s", name)
 }
 
-func (sl *Kubelet) RunContainer(manifest *api.ContainerManifest, container *api.Container) (name string, err error) {
-	err = sl.pullImage(container.Image)
+// Create and start a container for container of manifest. If networkContainerID is set, the
+// container joins the network of that container instead of getting its own. The image is
+// pulled unless pulls, which may be nil, has the result of pulling it already.
+func (sl *Kubelet) RunContainer(manifest *api.ContainerManifest, container *api.Container, networkContainerID string, pulls map[string]error) (name string, err error) {
+	err, pulled := pulls[imagePullKey(container)]
+	if !pulled {
+		err = sl.pullImage(container)
+	}
 	if err != nil {
+		sl.LogEvent(&api.Event{
+			Event:     "PULL_FAILED",
+			Manifest:  &api.ContainerManifest{Id: manifest.Id},
+			Container: container,
+		})
 		return "", err
 	}
 
-	name = manifestAndContainerToDockerName(manifest, container)
-	envVariables := []string{}
-	for _, value := range container.Env {
-		envVariables = append(envVariables, fmt.Sprintf("%s=%s", value.Name, value.Value))
-	}
-
-	volumes := map[string]struct{}{}
-	binds := []string{}
-	for _, volume := range container.VolumeMounts {
-		volumes[volume.MountPath] = struct{}{}
-		basePath := "/exports/" + volume.Name + ":" + volume.MountPath
-		if volume.ReadOnly {
-			basePath += ":ro"
-		}
-		binds = append(binds, basePath)
-	}
-
-	exposedPorts := map[docker.Port]struct{}{}
-	portBindings := map[docker.Port][]docker.PortBinding{}
-	for _, port := range container.Ports {
-		interiorPort := port.ContainerPort
-		exteriorPort := port.HostPort
-		// Some of this port stuff is under-documented voodoo.
-		// See http://stackoverflow.com/questions/20428302/binding-a-port-to-a-host-interface-using-the-rest-api
-		dockerPort := docker.Port(strconv.Itoa(interiorPort) + "/tcp")
-		exposedPorts[dockerPort] = struct{}{}
-		portBindings[dockerPort] = []docker.PortBinding{
-			{
-				HostPort: strconv.Itoa(exteriorPort),
-			},
-		}
-	}
-	var cmdList []string
-	if len(container.Command) > 0 {
-		cmdList = strings.Split(container.Command, " ")
-	}
-	opts := docker.CreateContainerOptions{
-		Name: name,
-		Config: &docker.Config{
-			Image:        container.Image,
-			ExposedPorts: exposedPorts,
-			Env:          envVariables,
-			Volumes:      volumes,
-			WorkingDir:   container.WorkingDir,
-			Cmd:          cmdList,
-		},
-	}
-	dockerContainer, err := sl.DockerClient.CreateContainer(opts)
+	volumePaths, err := sl.mountVolumes(manifest, container)
 	if err != nil {
 		return "", err
 	}
-	return name, sl.DockerClient.StartContainer(dockerContainer.ID, &docker.HostConfig{
-		PortBindings: portBindings,
-		Binds:        binds,
+	name = manifestAndContainerToDockerName(manifest, container)
+	id, err := sl.Runtime.CreateContainer(manifest, container, ContainerOptions{
+		Name:               name,
+		VolumePaths:        volumePaths,
+		NetworkContainerID: networkContainerID,
 	})
+	if err != nil {
+		return "", err
+	}
+	return name, sl.Runtime.StartContainer(id)
+}
+
+// Returns the pull policy of container, defaulting it by the tag of its image.
+func imagePullPolicy(container *api.Container) api.PullPolicy {
+	if len(container.ImagePullPolicy) > 0 {
+		return container.ImagePullPolicy
+	}
+	if _, tag := parseImageName(container.Image); tag == "latest" {
+		return api.PullAlways
+	}
+	return api.PullIfNotPresent
+}
+
+// Identifies the pull of the image of container, as containers sharing an image may still
+// differ in their pull policy.
+func imagePullKey(container *api.Container) string {
+	return string(imagePullPolicy(container)) + " " + container.Image
+}
+
+// Make the image of container available according to its pull policy.
+func (sl *Kubelet) pullImage(container *api.Container) error {
+	switch policy := imagePullPolicy(container); policy {
+	case api.PullAlways:
+		return sl.Runtime.PullImage(container.Image)
+	case api.PullIfNotPresent, api.PullNever:
+		present, err := sl.Runtime.IsImagePresent(container.Image)
+		if err != nil || present {
+			return err
+		}
+		if policy == api.PullNever {
+			return fmt.Errorf("image %s is not present and its pull policy is %s", container.Image, policy)
+		}
+		return sl.Runtime.PullImage(container.Image)
+	default:
+		return fmt.Errorf("unknown image pull policy %q", policy)
+	}
+}
+
+// Pull the images of containers in parallel, each image once. Returns the result of each
+// pull, keyed by imagePullKey, to be passed to RunContainer.
+func (sl *Kubelet) pullImages(containers []*api.Container) map[string]error {
+	pulls := map[string]error{}
+	started := map[string]bool{}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, container := range containers {
+		key := imagePullKey(container)
+		if started[key] {
+			continue
+		}
+		started[key] = true
+		wg.Add(1)
+		go func(container *api.Container) {
+			defer wg.Done()
+			err := sl.pullImage(container)
+			lock.Lock()
+			pulls[key] = err
+			lock.Unlock()
+		}(container)
+	}
+	wg.Wait()
+	return pulls
 }
 
-func (sl *Kubelet) pullImage(image string) error {
-	sl.pullLock.Lock()
-	defer sl.pullLock.Unlock()
-	cmd := exec.Command("docker", "pull", image)
-	err := cmd.Start()
+// Returns the containers of config which SyncManifests is going to start, so that their
+// images can be pulled ahead of time.
+func (sl *Kubelet) containersToStart(config []api.ContainerManifest, allContainers []RuntimeContainer) ([]*api.Container, error) {
+	running, err := sl.ListContainers()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return cmd.Wait()
+	exists := map[string]bool{}
+	for _, name := range running {
+		manifestId, containerName, hash := dockerNameToManifestAndContainer(name)
+		exists[manifestId+"/"+containerName+"/"+hash] = true
+	}
+	result := []*api.Container{}
+	for ix := range config {
+		manifest := &config[ix]
+		if len(sl.NetworkContainerImage) > 0 {
+			container := sl.networkContainer(manifest)
+			if !exists[manifest.Id+"/"+container.Name+"/"+hashContainer(container)] {
+				if start, _ := sl.canStartNetworkContainer(manifest, container, allContainers); start {
+					result = append(result, container)
+				}
+			}
+		}
+		for jx := range manifest.Containers {
+			container := &manifest.Containers[jx]
+			if exists[manifest.Id+"/"+container.Name+"/"+hashContainer(container)] {
+				continue
+			}
+			if start, _ := sl.canStartContainer(manifest, container, allContainers); start {
+				result = append(result, container)
+			}
+		}
+	}
+	return result, nil
 }
 
-// Creates a name which can be reversed to identify both manifest id and container name.
+// Creates a name which can be reversed to identify manifest id, container name and container hash.
 func manifestAndContainerToDockerName(manifest *api.ContainerManifest, container *api.Container) string {
 	// Note, manifest.Id could be blank.
-	return fmt.Sprintf("%s--%s--%x", escapeDash(container.Name), escapeDash(manifest.Id), rand.Uint32())
+	return fmt.Sprintf("%s--%s--%s--%x", escapeDash(container.Name), escapeDash(manifest.Id), hashContainer(container), rand.Uint32())
+}
+
+// Returns a short hash of the container spec, so that changes to the spec can be detected
+// from the docker name.
+func hashContainer(container *api.Container) string {
+	return fmt.Sprintf("%x", adler32.Checksum([]byte(util.MakeJSONString(container))))
 }
 
 // Converts "-" to "_-_" and "_" to "___" so that we can use "--" to meaningfully separate parts of a docker name.
@@ -433,8 +918,8 @@ func (sl *Kubelet) KillContainer(name string) error {
 	if err != nil {
 		return err
 	}
-	err = sl.DockerClient.StopContainer(id, 10)
-	manifestId, containerName := dockerNameToManifestAndContainer(name)
+	err = sl.Runtime.StopContainer(id, 10*time.Second)
+	manifestId, containerName, _ := dockerNameToManifestAndContainer(name)
 	sl.LogEvent(&api.Event{
 		Event: "STOP",
 		Manifest: &api.ContainerManifest{
@@ -471,11 +956,41 @@ func (sl *Kubelet) LogEvent(event *api.Event) error {
 	return err
 }
 
+// Returns the runtime's description of a container, by id or name, as JSON.
 func (sl *Kubelet) GetContainerInfo(name string) (string, error) {
-	info, err := sl.DockerClient.InspectContainer(name)
+	info, err := sl.Runtime.InspectContainer(name)
 	if err != nil {
 		return "{}", err
 	}
+	data, err := json.Marshal(info.Info)
+	return string(data), err
+}
+
+// Returns the runtime's description of the most recent container for each container name
+// of a manifest, as a JSON object keyed by container name.
+func (sl *Kubelet) GetManifestInfo(manifestID string) (string, error) {
+	containers, err := sl.Runtime.ListContainers(true)
+	if err != nil {
+		return "{}", err
+	}
+	latest := map[string]RuntimeContainer{}
+	for _, container := range containers {
+		id, containerName, _ := dockerNameToManifestAndContainer(container.Name)
+		if id != manifestID {
+			continue
+		}
+		if existing, ok := latest[containerName]; !ok || container.Created.After(existing.Created) {
+			latest[containerName] = container
+		}
+	}
+	info := map[string]interface{}{}
+	for containerName, container := range latest {
+		inspect, err := sl.Runtime.InspectContainer(container.ID)
+		if err != nil {
+			return "{}", err
+		}
+		info[containerName] = inspect.Info
+	}
 	data, err := json.Marshal(info)
 	return string(data), err
 }
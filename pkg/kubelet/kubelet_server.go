@@ -0,0 +1,82 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// KubeletServer is an HTTP handler which serves information about the containers
+// run by the kubelet. It handles:
+//
+//	GET /containerInfo?container=<docker id or name>
+//	GET /manifestInfo?manifest=<manifest id>
+type KubeletServer struct {
+	Kubelet kubeletInterface
+}
+
+// kubeletInterface contains all the kubelet methods required by the server.
+// For testablitiy.
+type kubeletInterface interface {
+	GetContainerInfo(name string) (string, error)
+	GetManifestInfo(manifestID string) (string, error)
+}
+
+func (s *KubeletServer) error(w http.ResponseWriter, err error) {
+	http.Error(w, fmt.Sprintf("Internal Error: %v", err), http.StatusInternalServerError)
+}
+
+func (s *KubeletServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	u, err := url.ParseRequestURI(req.RequestURI)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if req.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var data string
+	switch u.Path {
+	case "/containerInfo":
+		container := u.Query().Get("container")
+		if len(container) == 0 {
+			http.Error(w, "Missing container query arg", http.StatusBadRequest)
+			return
+		}
+		data, err = s.Kubelet.GetContainerInfo(container)
+	case "/manifestInfo":
+		manifest := u.Query().Get("manifest")
+		if len(manifest) == 0 {
+			http.Error(w, "Missing manifest query arg", http.StatusBadRequest)
+			return
+		}
+		data, err = s.Kubelet.GetManifestInfo(manifest)
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, data)
+}
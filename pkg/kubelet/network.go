@@ -0,0 +1,101 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+// The container name of the network holder of each manifest. It can't clash with the
+// containers of a manifest unless one of them is given the same unusual name.
+const networkContainerName = "network.holder"
+
+// Returns the spec of the network holder container of manifest. The holder does nothing but
+// own the network namespace, and the host ports, which all the containers of the manifest share.
+func (sl *Kubelet) networkContainer(manifest *api.ContainerManifest) *api.Container {
+	ports := []api.Port{}
+	for _, container := range manifest.Containers {
+		ports = append(ports, container.Ports...)
+	}
+	return &api.Container{
+		Name:            networkContainerName,
+		Image:           sl.NetworkContainerImage,
+		Ports:           ports,
+		ImagePullPolicy: api.PullIfNotPresent,
+	}
+}
+
+// Make sure the network holder container of manifest is running. Returns its name and id, and
+// whether it was just created, in which case the running containers of manifest are still in
+// the network of the holder it replaced. A holder which exited is restarted with the same
+// backoff as any other container.
+func (sl *Kubelet) syncNetworkContainer(manifest *api.ContainerManifest, containers []RuntimeContainer, pulls map[string]error) (name, id string, created bool, err error) {
+	container := sl.networkContainer(manifest)
+	exists, name, err := sl.ContainerExists(manifest, container)
+	if err != nil {
+		return "", "", false, err
+	}
+	if !exists {
+		if start, reason := sl.canStartNetworkContainer(manifest, container, containers); !start {
+			return "", "", false, fmt.Errorf("not starting the network container of %s: %s", manifest.Id, reason)
+		}
+		// A holder of an older spec of manifest, e.g. with other ports, still holds the host
+		// ports the new one needs.
+		if err := sl.killNetworkContainers(manifest); err != nil {
+			return "", "", false, err
+		}
+		log.Printf("Creating the network container of %s", manifest.Id)
+		name, err = sl.RunContainer(manifest, container, "", pulls)
+		if err != nil {
+			return "", "", false, err
+		}
+		sl.recordStart(manifest, container, containers)
+		created = true
+	}
+	id, err = sl.GetContainerID(name)
+	return name, id, created, err
+}
+
+// canStartContainer for the network holder of manifest. The holder is restarted whatever the
+// restart policy of manifest, as the other containers of manifest can't do without it.
+func (sl *Kubelet) canStartNetworkContainer(manifest *api.ContainerManifest, container *api.Container, containers []RuntimeContainer) (bool, string) {
+	always := *manifest
+	always.RestartPolicy = api.RestartAlways
+	return sl.canStartContainer(&always, container, containers)
+}
+
+// Stop the running network holders of manifest.
+func (sl *Kubelet) killNetworkContainers(manifest *api.ContainerManifest) error {
+	running, err := sl.ListContainers()
+	if err != nil {
+		return err
+	}
+	for _, name := range running {
+		manifestId, containerName, _ := dockerNameToManifestAndContainer(name)
+		if manifestId != manifest.Id || containerName != networkContainerName {
+			continue
+		}
+		log.Printf("Stopping the old network container %s of %s", name, manifest.Id)
+		if err := sl.KillContainer(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
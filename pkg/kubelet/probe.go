@@ -0,0 +1,171 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+const (
+	defaultProbeTimeout     = 1 * time.Second
+	defaultFailureThreshold = 3
+)
+
+// Run the liveness probe of container, which is running as name. Returns false once the probe
+// has failed as many times in a row as its failure threshold, true otherwise.
+func (sl *Kubelet) checkLiveness(container *api.Container, name string) bool {
+	probe := container.LivenessProbe
+	if probe == nil {
+		return true
+	}
+	info, err := sl.Runtime.InspectContainer(name)
+	if err != nil || info.State.Running == nil {
+		return true
+	}
+	initialDelay := time.Duration(probe.InitialDelaySeconds) * time.Second
+	if time.Since(info.State.Running.StartedAt) < initialDelay {
+		return true
+	}
+	if sl.livenessFailures == nil {
+		sl.livenessFailures = map[string]int{}
+	}
+	err = sl.runProbe(probe, container, info)
+	if err == nil {
+		delete(sl.livenessFailures, info.ID)
+		return true
+	}
+	sl.livenessFailures[info.ID]++
+	log.Printf("Liveness probe of %s failed (%d in a row): %v", name, sl.livenessFailures[info.ID], err)
+	threshold := probe.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	if sl.livenessFailures[info.ID] < threshold {
+		return true
+	}
+	delete(sl.livenessFailures, info.ID)
+	return false
+}
+
+// Run the readiness probe of container, described by info, which is running. Returns whether
+// the container is ready.
+func (sl *Kubelet) checkReadiness(container *api.Container, info *RuntimeContainerInfo) bool {
+	probe := container.ReadinessProbe
+	if probe == nil {
+		return true
+	}
+	initialDelay := time.Duration(probe.InitialDelaySeconds) * time.Second
+	if time.Since(info.State.Running.StartedAt) < initialDelay {
+		return false
+	}
+	err := sl.runProbe(&api.LivenessProbe{
+		HTTPGet:        probe.HTTPGet,
+		TCPSocket:      probe.TCPSocket,
+		Exec:           probe.Exec,
+		TimeoutSeconds: probe.TimeoutSeconds,
+	}, container, info)
+	if err != nil {
+		log.Printf("Readiness probe of %s failed: %v", info.Name, err)
+		return false
+	}
+	return true
+}
+
+// Run probe once against the container described by info. Returns nil if it succeeded.
+func (sl *Kubelet) runProbe(probe *api.LivenessProbe, container *api.Container, info *RuntimeContainerInfo) error {
+	timeout := time.Duration(probe.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	switch {
+	case probe.HTTPGet != nil:
+		port, err := findPort(container, probe.HTTPGet.Port)
+		if err != nil {
+			return err
+		}
+		host := probe.HTTPGet.Host
+		if len(host) == 0 {
+			host = info.IP
+		}
+		url := fmt.Sprintf("http://%s/%s", net.JoinHostPort(host, strconv.Itoa(port)), strings.TrimPrefix(probe.HTTPGet.Path, "/"))
+		client := &http.Client{Timeout: timeout}
+		response, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("GET %s returned %s", url, response.Status)
+		}
+		return nil
+	case probe.TCPSocket != nil:
+		port, err := findPort(container, probe.TCPSocket.Port)
+		if err != nil {
+			return err
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(info.IP, strconv.Itoa(port)), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case probe.Exec != nil:
+		type result struct {
+			exitCode int
+			err      error
+		}
+		done := make(chan result, 1)
+		go func() {
+			exitCode, err := sl.Runtime.ExecInContainer(info.ID, probe.Exec.Command)
+			done <- result{exitCode, err}
+		}()
+		select {
+		case r := <-done:
+			if r.err != nil {
+				return r.err
+			}
+			if r.exitCode != 0 {
+				return fmt.Errorf("%v exited with code %d", probe.Exec.Command, r.exitCode)
+			}
+			return nil
+		case <-time.After(timeout):
+			return fmt.Errorf("%v timed out after %v", probe.Exec.Command, timeout)
+		}
+	default:
+		return fmt.Errorf("probe of %s has no handler", container.Name)
+	}
+}
+
+// Returns the number of port, which is either a number or the name of one of the ports of container.
+func findPort(container *api.Container, port string) (int, error) {
+	if number, err := strconv.Atoi(port); err == nil {
+		return number, nil
+	}
+	for _, containerPort := range container.Ports {
+		if containerPort.Name == port {
+			return containerPort.ContainerPort, nil
+		}
+	}
+	return 0, fmt.Errorf("container %s has no port %q", container.Name, port)
+}
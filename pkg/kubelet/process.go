@@ -0,0 +1,256 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+// ProcessRuntime is a ContainerRuntime which runs the command of each container as a
+// plain process on the host, with the container's environment and working directory.
+// Images, resource limits, volumes and network containers are ignored. Containers only live
+// in memory, so they are forgotten when the kubelet restarts.
+type ProcessRuntime struct {
+	lock       sync.Mutex
+	containers map[string]*processContainer
+}
+
+type processContainer struct {
+	id      string
+	name    string
+	created time.Time
+	cmd     *exec.Cmd
+	// Closed once the process has exited.
+	done  chan struct{}
+	state api.ContainerState
+}
+
+// MakeProcessRuntime makes a ContainerRuntime running containers as host processes.
+func MakeProcessRuntime() *ProcessRuntime {
+	return &ProcessRuntime{
+		containers: map[string]*processContainer{},
+	}
+}
+
+func (p *ProcessRuntime) PullImage(image string) error {
+	return nil
+}
+
+func (p *ProcessRuntime) IsImagePresent(image string) (bool, error) {
+	return true, nil
+}
+
+func (p *ProcessRuntime) CreateContainer(manifest *api.ContainerManifest, container *api.Container, opts ContainerOptions) (string, error) {
+	args := append(append([]string{}, container.Command...), container.Args...)
+	if len(args) == 0 {
+		return "", fmt.Errorf("container %s has no command to run", container.Name)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = []string{}
+	for _, value := range container.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", value.Name, value.Value))
+	}
+	cmd.Dir = container.WorkingDir
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	id := fmt.Sprintf("%016x", rand.Uint64())
+	p.containers[id] = &processContainer{
+		id:      id,
+		name:    opts.Name,
+		created: time.Now(),
+		cmd:     cmd,
+		done:    make(chan struct{}),
+		state:   api.ContainerState{Waiting: &api.ContainerStateWaiting{Reason: "not started"}},
+	}
+	return id, nil
+}
+
+func (p *ProcessRuntime) StartContainer(id string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	container, err := p.find(id)
+	if err != nil {
+		return err
+	}
+	if container.state.Waiting == nil {
+		return fmt.Errorf("container %s was already started", id)
+	}
+	startedAt := time.Now()
+	if err := container.cmd.Start(); err != nil {
+		container.state = api.ContainerState{Terminated: &api.ContainerStateTerminated{
+			ExitCode:   -1,
+			Reason:     err.Error(),
+			StartedAt:  startedAt,
+			FinishedAt: startedAt,
+		}}
+		close(container.done)
+		return err
+	}
+	container.state = api.ContainerState{Running: &api.ContainerStateRunning{StartedAt: startedAt}}
+	go p.wait(container, startedAt)
+	return nil
+}
+
+// Wait for the process of container to exit, and record how it exited.
+func (p *ProcessRuntime) wait(container *processContainer, startedAt time.Time) {
+	err := container.cmd.Wait()
+	terminated := &api.ContainerStateTerminated{
+		ExitCode:   container.cmd.ProcessState.ExitCode(),
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		terminated.Reason = err.Error()
+	} else if terminated.ExitCode < 0 {
+		terminated.Reason = container.cmd.ProcessState.String()
+	}
+	p.lock.Lock()
+	container.state = api.ContainerState{Terminated: terminated}
+	p.lock.Unlock()
+	close(container.done)
+}
+
+func (p *ProcessRuntime) StopContainer(id string, timeout time.Duration) error {
+	p.lock.Lock()
+	container, err := p.find(id)
+	p.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if container.cmd.Process == nil {
+		return nil
+	}
+	select {
+	case <-container.done:
+		return nil
+	default:
+	}
+	if err := container.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return container.cmd.Process.Kill()
+	}
+	select {
+	case <-container.done:
+		return nil
+	case <-time.After(timeout):
+		return container.cmd.Process.Kill()
+	}
+}
+
+func (p *ProcessRuntime) RemoveContainer(id string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	container, err := p.find(id)
+	if err != nil {
+		return err
+	}
+	if container.state.Running != nil {
+		return fmt.Errorf("container %s is running", id)
+	}
+	delete(p.containers, container.id)
+	return nil
+}
+
+func (p *ProcessRuntime) ListContainers(all bool) ([]RuntimeContainer, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := []RuntimeContainer{}
+	for _, container := range p.containers {
+		if !all && container.state.Running == nil {
+			continue
+		}
+		result = append(result, RuntimeContainer{
+			ID:      container.id,
+			Name:    container.name,
+			Created: container.created,
+		})
+	}
+	return result, nil
+}
+
+func (p *ProcessRuntime) InspectContainer(id string) (*RuntimeContainerInfo, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	container, err := p.find(id)
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]interface{}{
+		"Id":      container.id,
+		"Name":    container.name,
+		"Created": container.created,
+		"Path":    container.cmd.Path,
+		"Args":    container.cmd.Args,
+		"Env":     container.cmd.Env,
+		"Dir":     container.cmd.Dir,
+		"State":   container.state,
+	}
+	if container.cmd.Process != nil {
+		info["Pid"] = container.cmd.Process.Pid
+	}
+	return &RuntimeContainerInfo{
+		ID:    container.id,
+		Name:  container.name,
+		State: container.state,
+		// Processes share the network of the host.
+		IP:   "127.0.0.1",
+		Info: info,
+	}, nil
+}
+
+// Runs cmd on the host, with the environment and working directory of the container.
+func (p *ProcessRuntime) ExecInContainer(id string, cmd []string) (int, error) {
+	if len(cmd) == 0 {
+		return 0, fmt.Errorf("no command to run")
+	}
+	p.lock.Lock()
+	container, err := p.find(id)
+	p.lock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	command := exec.Command(cmd[0], cmd[1:]...)
+	command.Env = container.cmd.Env
+	command.Dir = container.cmd.Dir
+	err = command.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// Find a container by id or name. p.lock must be held.
+func (p *ProcessRuntime) find(id string) (*processContainer, error) {
+	if container, ok := p.containers[id]; ok {
+		return container, nil
+	}
+	for _, container := range p.containers {
+		if container.name == id {
+			return container, nil
+		}
+	}
+	return nil, fmt.Errorf("no such container: %s", id)
+}
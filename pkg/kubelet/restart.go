@@ -0,0 +1,221 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+const (
+	// How long the kubelet waits before restarting a container which exited for the first time.
+	restartBackoffBase = 10 * time.Second
+	// The longest it waits between restarts of a crash looping container. A container which
+	// ran for at least this long is restarted right away, and its backoff starts over.
+	restartBackoffMax = 5 * time.Minute
+	// The number of exited containers kept for each container of a manifest. The newest one
+	// tells how the container last exited, older ones are kept for debugging.
+	maxDeadContainers = 2
+)
+
+// restartState is what the kubelet remembers about the restarts of a container of a manifest.
+type restartState struct {
+	// The number of times a new container was started after the previous one exited.
+	count int
+	// The exited container backoff was last computed for.
+	exitedID string
+	// How long to wait after exitedID finished before starting a new container.
+	backoff time.Duration
+}
+
+// Identifies a container of a manifest in sl.restarts. Containers created from an older spec
+// of the container don't share its state, they are replaced rather than restarted.
+func restartKey(manifestId, containerName, hash string) string {
+	return manifestId + "/" + containerName + "/" + hash
+}
+
+// Returns the restart state of container of manifest. A container the kubelet doesn't know
+// about yet, e.g. because the kubelet restarted, starts with a count taken from history.
+func (sl *Kubelet) restartStateOf(manifest *api.ContainerManifest, container *api.Container, history []RuntimeContainer) *restartState {
+	if sl.restarts == nil {
+		sl.restarts = map[string]*restartState{}
+	}
+	key := restartKey(manifest.Id, container.Name, hashContainer(container))
+	state, ok := sl.restarts[key]
+	if !ok {
+		state = &restartState{}
+		if len(history) > 1 {
+			state.count = len(history) - 1
+		}
+		sl.restarts[key] = state
+	}
+	return state
+}
+
+// Returns the runtime containers created for container of manifest, newest first. Containers
+// created from an older spec of container aren't included, they are replaced rather than restarted.
+func containerHistory(manifest *api.ContainerManifest, container *api.Container, containers []RuntimeContainer) []RuntimeContainer {
+	hash := hashContainer(container)
+	history := []RuntimeContainer{}
+	for _, runtimeContainer := range containers {
+		manifestId, containerName, containerHash := dockerNameToManifestAndContainer(runtimeContainer.Name)
+		if manifestId == manifest.Id && containerName == container.Name && containerHash == hash {
+			history = append(history, runtimeContainer)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Created.After(history[j].Created)
+	})
+	return history
+}
+
+// Does the restart policy of manifest ask for a container which exited like terminated to be restarted?
+func shouldRestart(manifest *api.ContainerManifest, terminated *api.ContainerStateTerminated) bool {
+	switch manifest.RestartPolicy {
+	case api.RestartNever:
+		return false
+	case api.RestartOnFailure:
+		return terminated.ExitCode != 0
+	default:
+		return true
+	}
+}
+
+// How long to wait before starting a container again, after its last run lasted lastRun and
+// the wait before that run was previous. The wait doubles with every restart, up to
+// restartBackoffMax, and starts over once the container ran for restartBackoffMax.
+func restartBackoff(previous, lastRun time.Duration) time.Duration {
+	if lastRun >= restartBackoffMax {
+		return 0
+	}
+	if previous <= 0 {
+		return restartBackoffBase
+	}
+	if previous*2 > restartBackoffMax {
+		return restartBackoffMax
+	}
+	return previous * 2
+}
+
+// Returns how the latest container in history exited. A container which was created but never
+// started, e.g. because starting it failed, is treated as having exited when it was created.
+func (sl *Kubelet) lastTermination(history []RuntimeContainer) (*api.ContainerStateTerminated, error) {
+	info, err := sl.Runtime.InspectContainer(history[0].ID)
+	if err != nil {
+		return nil, err
+	}
+	if info.State.Terminated != nil {
+		return info.State.Terminated, nil
+	}
+	return &api.ContainerStateTerminated{
+		ExitCode:   -1,
+		Reason:     "never started",
+		StartedAt:  history[0].Created,
+		FinishedAt: history[0].Created,
+	}, nil
+}
+
+// Decides whether a new container should be started for container of manifest, which isn't running.
+// When it shouldn't, the reason is returned.
+func (sl *Kubelet) canStartContainer(manifest *api.ContainerManifest, container *api.Container, containers []RuntimeContainer) (bool, string) {
+	history := containerHistory(manifest, container, containers)
+	if len(history) == 0 {
+		return true, ""
+	}
+	terminated, err := sl.lastTermination(history)
+	if err != nil {
+		return false, err.Error()
+	}
+	if !shouldRestart(manifest, terminated) {
+		return false, fmt.Sprintf("exited with code %d, restart policy is %s", terminated.ExitCode, manifest.RestartPolicy)
+	}
+	state := sl.restartStateOf(manifest, container, history)
+	if state.exitedID != history[0].ID {
+		state.exitedID = history[0].ID
+		state.backoff = restartBackoff(state.backoff, terminated.FinishedAt.Sub(terminated.StartedAt))
+	}
+	if wait := time.Until(terminated.FinishedAt.Add(state.backoff)); wait > 0 {
+		return false, fmt.Sprintf("crash loop backoff, restarting in %v", wait.Round(time.Second))
+	}
+	return true, ""
+}
+
+// Record that a new container was started for container of manifest. It counts as a restart
+// if containers has an earlier one.
+func (sl *Kubelet) recordStart(manifest *api.ContainerManifest, container *api.Container, containers []RuntimeContainer) {
+	if history := containerHistory(manifest, container, containers); len(history) > 0 {
+		sl.restartStateOf(manifest, container, history).count++
+	}
+}
+
+// Remove the exited containers the kubelet created, keeping the newest maxDeadContainers of
+// each container in config. The restart state of containers which aren't in config anymore
+// is forgotten.
+func (sl *Kubelet) removeDeadContainers(config []api.ContainerManifest) error {
+	running, err := sl.Runtime.ListContainers(false)
+	if err != nil {
+		return err
+	}
+	all, err := sl.Runtime.ListContainers(true)
+	if err != nil {
+		return err
+	}
+	isRunning := map[string]bool{}
+	for _, container := range running {
+		isRunning[container.ID] = true
+	}
+	keep := map[string]int{}
+	for ix := range config {
+		manifest := &config[ix]
+		for jx := range manifest.Containers {
+			container := &manifest.Containers[jx]
+			keep[restartKey(manifest.Id, container.Name, hashContainer(container))] = maxDeadContainers
+		}
+		if len(sl.NetworkContainerImage) > 0 {
+			container := sl.networkContainer(manifest)
+			keep[restartKey(manifest.Id, container.Name, hashContainer(container))] = maxDeadContainers
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Created.After(all[j].Created)
+	})
+	var resultErr error
+	for _, container := range all {
+		if isRunning[container.ID] || !isKubeletContainerName(container.Name) {
+			continue
+		}
+		key := restartKey(dockerNameToManifestAndContainer(container.Name))
+		if keep[key] > 0 {
+			keep[key]--
+			continue
+		}
+		log.Printf("Removing exited container %s", container.Name)
+		if err := sl.Runtime.RemoveContainer(container.ID); err != nil {
+			resultErr = err
+		}
+	}
+	for key := range sl.restarts {
+		if _, ok := keep[key]; !ok {
+			delete(sl.restarts, key)
+		}
+	}
+	return resultErr
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+// ContainerRuntime is the interface the kubelet uses to run containers on its host.
+// Containers are identified by the id the runtime assigns, or by the name the kubelet
+// gave them when they were created.
+type ContainerRuntime interface {
+	// Make image available on this host, fetching it even if it is already present.
+	PullImage(image string) error
+	// Is image available on this host?
+	IsImagePresent(image string) (bool, error)
+	// Create, but don't start, a container for container of manifest. Returns the id of the
+	// new container.
+	CreateContainer(manifest *api.ContainerManifest, container *api.Container, opts ContainerOptions) (string, error)
+	StartContainer(id string) error
+	// Stop a container, killing it if it hasn't exited after timeout.
+	StopContainer(id string, timeout time.Duration) error
+	// Remove a container which isn't running.
+	RemoveContainer(id string) error
+	// List the running containers, or all containers including exited ones if all is set.
+	ListContainers(all bool) ([]RuntimeContainer, error)
+	// Describe the container with the given id or name.
+	InspectContainer(id string) (*RuntimeContainerInfo, error)
+	// Run cmd inside the running container id, and return its exit code.
+	ExecInContainer(id string, cmd []string) (int, error)
+}
+
+// ContainerOptions are the settings of a new container which the kubelet decides, rather than
+// the container's spec.
+type ContainerOptions struct {
+	// The name to give the container.
+	Name string
+	// The host directory backing each volume of the manifest, keyed by volume name.
+	VolumePaths map[string]string
+	// If set, the container joins the network of this container, which owns the host
+	// ports, instead of getting a network of its own.
+	NetworkContainerID string
+}
+
+// RuntimeContainer is a container listed by a ContainerRuntime.
+type RuntimeContainer struct {
+	ID string
+	// The name the kubelet gave the container, see manifestAndContainerToDockerName.
+	Name    string
+	Created time.Time
+}
+
+// RuntimeContainerInfo is the detailed description of a container.
+type RuntimeContainerInfo struct {
+	ID    string
+	Name  string
+	State api.ContainerState
+	// The address the container can be reached on from the host.
+	IP string
+	// Runtime specific details, served as is by the kubelet's info server.
+	Info interface{}
+}
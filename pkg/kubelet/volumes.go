@@ -0,0 +1,119 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+// The directory, under the kubelet's root directory, holding a directory per task.
+const tasksDirectory = "tasks"
+
+// Returns the directory of manifest under the kubelet's root directory, where its emptyDir
+// volumes live.
+func (sl *Kubelet) taskDirectory(manifest *api.ContainerManifest) (string, error) {
+	if len(sl.RootDirectory) == 0 {
+		return "", fmt.Errorf("the kubelet has no root directory for task %s", manifest.Id)
+	}
+	id := manifest.Id
+	if len(id) == 0 || id == "." || id == ".." || filepath.Base(id) != id {
+		return "", fmt.Errorf("manifest id %q can't be used as a directory name", id)
+	}
+	return filepath.Join(sl.RootDirectory, tasksDirectory, id), nil
+}
+
+// Returns the host directory backing each volume which container mounts, creating the
+// directories of emptyDir volumes. Mounted volumes which the manifest doesn't declare are
+// the legacy /exports/<name> directory.
+func (sl *Kubelet) mountVolumes(manifest *api.ContainerManifest, container *api.Container) (map[string]string, error) {
+	declared := map[string]*api.Volume{}
+	for ix := range manifest.Volumes {
+		declared[manifest.Volumes[ix].Name] = &manifest.Volumes[ix]
+	}
+	paths := map[string]string{}
+	for _, mount := range container.VolumeMounts {
+		volume, ok := declared[mount.Name]
+		switch {
+		case !ok || volume.Source == nil:
+			paths[mount.Name] = "/exports/" + mount.Name
+		case volume.Source.HostDir != nil:
+			paths[mount.Name] = volume.Source.HostDir.Path
+		case volume.Source.EmptyDir != nil:
+			taskDir, err := sl.taskDirectory(manifest)
+			if err != nil {
+				return nil, err
+			}
+			path := filepath.Join(taskDir, "volumes", mount.Name)
+			// Containers may not run as the kubelet's user.
+			if err := os.MkdirAll(path, 0777); err != nil {
+				return nil, err
+			}
+			if err := os.Chmod(path, 0777); err != nil {
+				return nil, err
+			}
+			paths[mount.Name] = path
+		default:
+			return nil, fmt.Errorf("volume %s has no source", mount.Name)
+		}
+	}
+	return paths, nil
+}
+
+// Delete the directories of tasks which aren't in config anymore, along with their emptyDir
+// volumes. Nothing is deleted until every configuration source has been heard from, and the
+// directory of a task which still has running containers is kept.
+func (sl *Kubelet) cleanupTaskDirectories(config []api.ContainerManifest) error {
+	if len(sl.RootDirectory) == 0 || !sl.sourcesReady {
+		return nil
+	}
+	desired := map[string]bool{}
+	for _, manifest := range config {
+		desired[manifest.Id] = true
+	}
+	running, err := sl.ListContainers()
+	if err != nil {
+		return err
+	}
+	for _, name := range running {
+		manifestId, _, _ := dockerNameToManifestAndContainer(name)
+		desired[manifestId] = true
+	}
+	root := filepath.Join(sl.RootDirectory, tasksDirectory)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var resultErr error
+	for _, entry := range entries {
+		if desired[entry.Name()] {
+			continue
+		}
+		log.Printf("Deleting directory of removed task %s", entry.Name())
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			resultErr = err
+		}
+	}
+	return resultErr
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"log"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/registry"
+	"github.com/kawabatas/toy-k8s/third_party/github.com/coreos/go-etcd/etcd"
+)
+
+// ServiceConfigHandler is implemented by things which want to be told the full
+// set of services whenever it changes.
+type ServiceConfigHandler interface {
+	OnUpdate(services []api.Service)
+}
+
+// EndpointsConfigHandler is implemented by things which want to be told the full
+// set of endpoints whenever it changes.
+type EndpointsConfigHandler interface {
+	OnUpdate(endpoints []api.Endpoints)
+}
+
+// ConfigSourceEtcd reads services and their endpoints from etcd, and passes them on
+// to the handlers every time anything under /registry/services changes.
+type ConfigSourceEtcd struct {
+	etcdClient       registry.EtcdClient
+	serviceRegistry  registry.ServiceRegistry
+	serviceHandler   ServiceConfigHandler
+	endpointsHandler EndpointsConfigHandler
+	resyncPeriod     time.Duration
+}
+
+// NewConfigSourceEtcd creates a ConfigSourceEtcd. Even without changes, the
+// configuration is re-read every resyncPeriod.
+func NewConfigSourceEtcd(client registry.EtcdClient, serviceHandler ServiceConfigHandler, endpointsHandler EndpointsConfigHandler, resyncPeriod time.Duration) *ConfigSourceEtcd {
+	return &ConfigSourceEtcd{
+		etcdClient:       client,
+		serviceRegistry:  registry.MakeEtcdRegistry(client, nil),
+		serviceHandler:   serviceHandler,
+		endpointsHandler: endpointsHandler,
+		resyncPeriod:     resyncPeriod,
+	}
+}
+
+// Run syncs the configuration, then keeps it up to date until the etcd watch fails.
+// Meant to be run via util.Forever.
+func (s *ConfigSourceEtcd) Run() {
+	watchChannel := make(chan *etcd.Response)
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		_, err := s.etcdClient.Watch("/registry/services", 0, true, watchChannel, stop)
+		if err != nil && err != etcd.ErrWatchStoppedByUser {
+			log.Printf("etcd watch on /registry/services ended: %v", err)
+		}
+	}()
+
+	s.sync()
+	for {
+		select {
+		case response, ok := <-watchChannel:
+			if !ok {
+				return
+			}
+			log.Printf("Got change: %#v", response)
+		case <-time.After(s.resyncPeriod):
+		}
+		s.sync()
+	}
+}
+
+// sync reads all services and endpoints, and hands them to the handlers.
+func (s *ConfigSourceEtcd) sync() {
+	services, err := s.serviceRegistry.ListServices()
+	if err != nil {
+		log.Printf("Failed to list services: %v", err)
+		return
+	}
+	endpoints := []api.Endpoints{}
+	for _, service := range services.Items {
+		serviceEndpoints, err := s.serviceRegistry.GetEndpoints(service.ID)
+		if err != nil {
+			if !api.IsNotFound(err) {
+				log.Printf("Failed to get endpoints for %s: %v", service.ID, err)
+			}
+			continue
+		}
+		endpoints = append(endpoints, *serviceEndpoints)
+	}
+	s.endpointsHandler.OnUpdate(endpoints)
+	s.serviceHandler.OnUpdate(services.Items)
+}
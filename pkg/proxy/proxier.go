@@ -0,0 +1,145 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package proxy implements a userspace TCP proxy, which forwards connections to the
+// port of a service on to the endpoints of that service.
+package proxy
+
+import (
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/util"
+)
+
+type serviceInfo struct {
+	port     int
+	listener net.Listener
+}
+
+// Proxier is a simple proxy for TCP connections between a localhost:lport
+// and services that provide the actual implementations.
+type Proxier struct {
+	loadBalancer LoadBalancer
+	address      string
+	lock         sync.Mutex
+	serviceMap   map[string]*serviceInfo
+}
+
+// NewProxier returns a new Proxier given a LoadBalancer and an address to
+// listen on for the ports of all services.
+func NewProxier(loadBalancer LoadBalancer, address string) *Proxier {
+	return &Proxier{
+		loadBalancer: loadBalancer,
+		address:      address,
+		serviceMap:   make(map[string]*serviceInfo),
+	}
+}
+
+// OnUpdate manages the active set of service proxies.
+// Active service proxies are reinitialized if found in the update set or
+// shutdown if missing from the update set.
+func (proxier *Proxier) OnUpdate(services []api.Service) {
+	proxier.lock.Lock()
+	defer proxier.lock.Unlock()
+	activeServices := make(map[string]bool)
+	for _, service := range services {
+		activeServices[service.ID] = true
+		info, exists := proxier.serviceMap[service.ID]
+		if exists && info.port == service.Port {
+			continue
+		}
+		if exists {
+			log.Printf("Port for service %s changed from %d to %d", service.ID, info.port, service.Port)
+			proxier.stopProxy(service.ID, info)
+		}
+		log.Printf("Adding a new service %s on port %d", service.ID, service.Port)
+		listener, err := net.Listen("tcp", net.JoinHostPort(proxier.address, strconv.Itoa(service.Port)))
+		if err != nil {
+			log.Printf("Failed to start listening for %s on %d: %v", service.ID, service.Port, err)
+			continue
+		}
+		proxier.serviceMap[service.ID] = &serviceInfo{
+			port:     service.Port,
+			listener: listener,
+		}
+		go proxier.acceptHandler(service.ID, listener)
+	}
+	for name, info := range proxier.serviceMap {
+		if !activeServices[name] {
+			proxier.stopProxy(name, info)
+		}
+	}
+}
+
+// stopProxy closes the listener of a service. Must be called with the lock held.
+func (proxier *Proxier) stopProxy(service string, info *serviceInfo) {
+	log.Printf("Stopping proxy for %s on port %d", service, info.port)
+	info.listener.Close()
+	delete(proxier.serviceMap, service)
+}
+
+// acceptHandler proxies every connection accepted on listener, until listener is closed.
+func (proxier *Proxier) acceptHandler(service string, listener net.Listener) {
+	defer util.HandleCrash()
+	for {
+		inConn, err := listener.Accept()
+		if err != nil {
+			log.Printf("Accept for %s ended: %v", service, err)
+			return
+		}
+		endpoint, err := proxier.loadBalancer.NextEndpoint(service, inConn.RemoteAddr())
+		if err != nil {
+			log.Printf("Couldn't find an endpoint for %s: %v", service, err)
+			inConn.Close()
+			continue
+		}
+		log.Printf("Mapped service %s to endpoint %s", service, endpoint)
+		outConn, err := net.Dial("tcp", endpoint)
+		if err != nil {
+			log.Printf("Dial to %s failed: %v", endpoint, err)
+			inConn.Close()
+			continue
+		}
+		go proxyConnection(inConn.(*net.TCPConn), outConn.(*net.TCPConn))
+	}
+}
+
+// proxyConnection copies data in both directions between in and out, until both
+// sides are done.
+func proxyConnection(in, out *net.TCPConn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go copyBytes(in, out, &wg)
+	go copyBytes(out, in, &wg)
+	wg.Wait()
+	in.Close()
+	out.Close()
+}
+
+func copyBytes(dst, src *net.TCPConn, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if _, err := io.Copy(dst, src); err != nil {
+		log.Printf("I/O error: %v", err)
+	}
+	// Let the other side know we are done writing.
+	dst.CloseWrite()
+	src.CloseRead()
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"sync"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+)
+
+// LoadBalancer is an interface for distributing incoming requests to service endpoints.
+type LoadBalancer interface {
+	// NextEndpoint returns the endpoint to handle a request for the given
+	// service and source address.
+	NextEndpoint(service string, srcAddr net.Addr) (string, error)
+}
+
+// LoadBalancerRR is a round-robin load balancer. It implements LoadBalancer.
+type LoadBalancerRR struct {
+	lock         sync.RWMutex
+	endpointsMap map[string][]string
+	rrIndex      map[string]int
+}
+
+// NewLoadBalancerRR returns a new LoadBalancerRR.
+func NewLoadBalancerRR() *LoadBalancerRR {
+	return &LoadBalancerRR{
+		endpointsMap: make(map[string][]string),
+		rrIndex:      make(map[string]int),
+	}
+}
+
+// NextEndpoint returns the endpoint after the one handed out last for service.
+func (lb *LoadBalancerRR) NextEndpoint(service string, srcAddr net.Addr) (string, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	endpoints, exists := lb.endpointsMap[service]
+	if !exists || len(endpoints) == 0 {
+		return "", fmt.Errorf("no endpoints for service %s", service)
+	}
+	index := lb.rrIndex[service] % len(endpoints)
+	lb.rrIndex[service] = index + 1
+	return endpoints[index], nil
+}
+
+// OnUpdate manages the registered service endpoints.
+// Registered endpoints are updated if found in the update set or
+// unregistered if missing from the update set.
+func (lb *LoadBalancerRR) OnUpdate(endpoints []api.Endpoints) {
+	registeredEndpoints := make(map[string]bool)
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	for _, endpoint := range endpoints {
+		existingEndpoints, exists := lb.endpointsMap[endpoint.Name]
+		if !exists || !reflect.DeepEqual(existingEndpoints, endpoint.Endpoints) {
+			log.Printf("LoadBalancerRR: Setting endpoints for %s to %+v", endpoint.Name, endpoint.Endpoints)
+			lb.endpointsMap[endpoint.Name] = endpoint.Endpoints
+			// Reset the round-robin index.
+			lb.rrIndex[endpoint.Name] = 0
+		}
+		registeredEndpoints[endpoint.Name] = true
+	}
+	// Remove endpoints missing from the update.
+	for name := range lb.endpointsMap {
+		if !registeredEndpoints[name] {
+			log.Printf("LoadBalancerRR: Removing endpoints for %s", name)
+			delete(lb.endpointsMap, name)
+			delete(lb.rrIndex, name)
+		}
+	}
+}
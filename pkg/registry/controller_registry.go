@@ -21,6 +21,7 @@ import (
 
 	"github.com/kawabatas/toy-k8s/pkg/api"
 	"github.com/kawabatas/toy-k8s/pkg/apiserver"
+	"github.com/kawabatas/toy-k8s/pkg/watch"
 )
 
 // Implementation of RESTStorage for the api server.
@@ -60,9 +61,27 @@ func (storage *ControllerRegistryStorage) Extract(body string) (interface{}, err
 }
 
 func (storage *ControllerRegistryStorage) Create(controller interface{}) error {
-	return storage.registry.CreateController(controller.(api.ReplicationController))
+	controllerObj := controller.(api.ReplicationController)
+	if len(controllerObj.ID) == 0 {
+		return api.NewInvalid("replicationController", controllerObj.ID, "id is unspecified")
+	}
+	if err := validatePorts(&controllerObj.DesiredState.TaskTemplate.DesiredState.Manifest); err != nil {
+		return api.NewInvalid("replicationController", controllerObj.ID, err.Error())
+	}
+	return storage.registry.CreateController(controllerObj)
 }
 
 func (storage *ControllerRegistryStorage) Update(controller interface{}) error {
-	return storage.registry.UpdateController(controller.(api.ReplicationController))
+	controllerObj := controller.(api.ReplicationController)
+	if len(controllerObj.ID) == 0 {
+		return api.NewInvalid("replicationController", controllerObj.ID, "id is unspecified")
+	}
+	if err := validatePorts(&controllerObj.DesiredState.TaskTemplate.DesiredState.Manifest); err != nil {
+		return api.NewInvalid("replicationController", controllerObj.ID, err.Error())
+	}
+	return storage.registry.UpdateController(controllerObj)
+}
+
+func (storage *ControllerRegistryStorage) Watch(url *url.URL) (watch.Interface, error) {
+	return storage.registry.WatchControllers(labelQueryFromURL(url))
 }
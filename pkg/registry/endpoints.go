@@ -0,0 +1,129 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package registry
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/client"
+)
+
+// EndpointController keeps the api.Endpoints of every service in sync with the tasks
+// which match the service's label selector.
+type EndpointController struct {
+	serviceRegistry ServiceRegistry
+	kubeClient      client.ClientInterface
+}
+
+func MakeEndpointController(serviceRegistry ServiceRegistry, kubeClient client.ClientInterface) *EndpointController {
+	return &EndpointController{
+		serviceRegistry: serviceRegistry,
+		kubeClient:      kubeClient,
+	}
+}
+
+// SyncServiceEndpoints recomputes the endpoints of every service, and stores the ones that changed.
+func (e *EndpointController) SyncServiceEndpoints() error {
+	services, err := e.serviceRegistry.ListServices()
+	if err != nil {
+		return err
+	}
+	tasks, err := e.kubeClient.ListTasks(nil)
+	if err != nil {
+		return err
+	}
+	var resultErr error
+	for _, service := range services.Items {
+		endpoints := api.Endpoints{
+			Name:      service.ID,
+			Endpoints: []string{},
+		}
+		for _, task := range tasks.Items {
+			if !LabelsMatch(task, &service.Labels) || !task.CurrentState.Ready {
+				continue
+			}
+			port, err := findHostPort(task)
+			if err != nil {
+				log.Printf("Skipping task %s for service %s: %v", task.ID, service.ID, err)
+				continue
+			}
+			endpoints.Endpoints = append(endpoints.Endpoints, net.JoinHostPort(task.CurrentState.Host, strconv.Itoa(port)))
+		}
+		// Tasks are listed in no particular order.
+		sort.Strings(endpoints.Endpoints)
+		current, err := e.serviceRegistry.GetEndpoints(service.ID)
+		if err == nil && sameEndpoints(current.Endpoints, endpoints.Endpoints) {
+			continue
+		}
+		if err != nil && !api.IsNotFound(err) {
+			log.Printf("Error getting endpoints of %s: %v", service.ID, err)
+		}
+		log.Printf("Updating endpoints of %s: %v", service.ID, endpoints.Endpoints)
+		if err := e.serviceRegistry.UpdateEndpoints(endpoints); err != nil {
+			log.Printf("Error updating endpoints of %s: %v", service.ID, err)
+			resultErr = err
+		}
+	}
+	return resultErr
+}
+
+// WatchTasks re-syncs endpoints whenever a task is added, changed or deleted.
+// Returns when the watch ends; meant to be run via util.Forever.
+func (e *EndpointController) WatchTasks() {
+	events, err := e.kubeClient.WatchTasks(nil, nil)
+	if err != nil {
+		log.Printf("Error watching tasks: %v", err)
+		return
+	}
+	for event := range events {
+		log.Printf("Task %s %s, syncing endpoints", event.Task.ID, event.Type)
+		if err := e.SyncServiceEndpoints(); err != nil {
+			log.Printf("Error syncing endpoints: %v", err)
+		}
+	}
+}
+
+// findHostPort returns the first port of the task that is exposed on its host.
+func findHostPort(task api.Task) (int, error) {
+	for _, container := range task.DesiredState.Manifest.Containers {
+		for _, port := range container.Ports {
+			// The service proxy only forwards TCP.
+			if port.HostPort != 0 && portProtocol(port) == api.ProtocolTCP {
+				return port.HostPort, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no host port")
+}
+
+// sameEndpoints compares two endpoint lists, treating a nil list as empty. An empty list
+// isn't stored, so it reads back as nil.
+func sameEndpoints(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -17,11 +17,13 @@ package registry
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/watch"
 	"github.com/kawabatas/toy-k8s/third_party/github.com/coreos/go-etcd/etcd"
 )
 
@@ -34,27 +36,27 @@ type EtcdClient interface {
 	Get(key string, sort, recursive bool) (*etcd.Response, error)
 	Set(key, value string, ttl uint64) (*etcd.Response, error)
 	Create(key, value string, ttl uint64) (*etcd.Response, error)
+	CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
 	Delete(key string, recursive bool) (*etcd.Response, error)
 	// I'd like to use directional channels here (e.g. <-chan) but this interface mimics
 	// the etcd client interface which doesn't, and it doesn't seem worth it to wrap the api.
 	Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error)
 }
 
-// EtcdRegistry is an implementation of both ControllerRegistry and TaskRegistry which is backed with etcd.
+// EtcdRegistry is an implementation of ControllerRegistry, TaskRegistry and ServiceRegistry which is backed with etcd.
 type EtcdRegistry struct {
 	etcdClient      EtcdClient
-	machines        []string
+	minionRegistry  MinionRegistry
 	manifestFactory ManifestFactory
 }
 
 // MakeEtcdRegistry creates an etcd registry.
 // 'client' is the connection to etcd
-// 'machines' is the list of machines
-// 'scheduler' is the scheduling algorithm to use.
-func MakeEtcdRegistry(client EtcdClient, machines []string) *EtcdRegistry {
+// 'minionRegistry' knows the machines tasks are looked up on.
+func MakeEtcdRegistry(client EtcdClient, minionRegistry MinionRegistry) *EtcdRegistry {
 	registry := &EtcdRegistry{
-		etcdClient: client,
-		machines:   machines,
+		etcdClient:     client,
+		minionRegistry: minionRegistry,
 	}
 	registry.manifestFactory = &BasicManifestFactory{}
 	return registry
@@ -64,6 +66,12 @@ func makeTaskKey(machine, taskID string) string {
 	return "/registry/hosts/" + machine + "/tasks/" + taskID
 }
 
+// MakeTaskStatusKey returns the key under which the kubelet of machine reports the
+// status of a task, as an api.TaskState.
+func MakeTaskStatusKey(machine, taskID string) string {
+	return "/registry/hosts/" + machine + "/status/" + taskID
+}
+
 func makeContainerKey(machine string) string {
 	return "/registry/hosts/" + machine + "/kubelet"
 }
@@ -72,9 +80,21 @@ func makeControllerKey(id string) string {
 	return "/registry/controllers/" + id
 }
 
+func makeServiceKey(name string) string {
+	return "/registry/services/specs/" + name
+}
+
+func makeEndpointsKey(name string) string {
+	return "/registry/services/endpoints/" + name
+}
+
 func (registry *EtcdRegistry) ListTasks(query *map[string]string) ([]api.Task, error) {
 	tasks := []api.Task{}
-	for _, machine := range registry.machines {
+	machines, err := registry.listMachines()
+	if err != nil {
+		return tasks, err
+	}
+	for _, machine := range machines {
 		machineTasks, err := registry.listTasksForMachine(machine)
 		if err != nil {
 			return tasks, err
@@ -96,13 +116,62 @@ func (registry *EtcdRegistry) GetTask(taskID string) (*api.Task, error) {
 func (registry *EtcdRegistry) CreateTask(machineIn string, task api.Task) error {
 	taskOut, machine, err := registry.findTask(task.ID)
 	if err == nil {
-		return fmt.Errorf("a task named %s already exists on %s (%#v)", task.ID, machine, taskOut)
+		log.Printf("a task named %s already exists on %s (%#v)", task.ID, machine, taskOut)
+		return api.NewAlreadyExists("task", task.ID)
 	}
 	return registry.runTask(task, machineIn)
 }
 
+// UpdateTask rewrites an existing task in place, both its record and its entry in the
+// manifest list of the machine it runs on, so that the kubelet picks up the change.
+// A task can't be moved to another machine this way.
 func (registry *EtcdRegistry) UpdateTask(task api.Task) error {
-	return errors.New("not implemented")
+	existing, machine, err := registry.findTask(task.ID)
+	if err != nil {
+		return err
+	}
+	for _, host := range []string{task.DesiredState.Host, task.CurrentState.Host} {
+		if len(host) != 0 && host != machine {
+			return api.NewInvalid("task", task.ID, fmt.Sprintf("host is immutable (%s, not %s)", machine, host))
+		}
+	}
+	resourceVersion := task.ResourceVersion
+	if resourceVersion == 0 {
+		resourceVersion = existing.ResourceVersion
+	}
+	task.ResourceVersion = 0
+	clearCurrentState(&task)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = registry.etcdClient.CompareAndSwap(makeTaskKey(machine, task.ID), string(data), 0, "", resourceVersion)
+	if isEtcdNotFound(err) {
+		return api.NewNotFound("task", task.ID)
+	}
+	if isEtcdTestFailed(err) {
+		return api.NewConflict("task", task.ID, fmt.Errorf("resourceVersion %d is out of date", resourceVersion))
+	}
+	if err != nil {
+		return err
+	}
+
+	manifest, err := registry.manifestFactory.MakeManifest(machine, task)
+	if err != nil {
+		return err
+	}
+	return registry.updateManifests(machine, func(manifests []api.ContainerManifest) ([]api.ContainerManifest, error) {
+		for ix := range manifests {
+			if manifests[ix].Id == task.ID {
+				manifests[ix] = manifest
+				return manifests, nil
+			}
+		}
+		// As in deleteTaskFromMachine, this indicates something is broken. The task
+		// exists, so put it back in the list.
+		log.Printf("Couldn't find: %s in %#v, adding it", task.ID, manifests)
+		return append(manifests, manifest), nil
+	})
 }
 
 func (registry *EtcdRegistry) DeleteTask(taskID string) error {
@@ -113,6 +182,81 @@ func (registry *EtcdRegistry) DeleteTask(taskID string) error {
 	return registry.deleteTaskFromMachine(machine, taskID)
 }
 
+// WatchTasks starts a watch on the tasks of every machine, sending only the tasks
+// which match query. Query may be nil in which case all tasks are sent.
+func (registry *EtcdRegistry) WatchTasks(query *map[string]string) (watch.Interface, error) {
+	filter := func(obj interface{}) bool {
+		return LabelsMatch(*obj.(*api.Task), query)
+	}
+	return watchEtcd(registry.etcdClient, "/registry/hosts", decodeTaskNode, filter), nil
+}
+
+// decodeTaskNode decodes nodes stored under /registry/hosts/<machine>/tasks/<id>,
+// and ignores everything else under /registry/hosts.
+func decodeTaskNode(node *etcd.Node) (interface{}, error) {
+	parts := strings.Split(strings.TrimPrefix(node.Key, "/registry/hosts/"), "/")
+	if len(parts) != 3 || parts[1] != "tasks" {
+		return nil, nil
+	}
+	task := api.Task{}
+	if len(node.Value) > 0 {
+		if err := json.Unmarshal([]byte(node.Value), &task); err != nil {
+			return nil, err
+		}
+	}
+	if len(task.ID) == 0 {
+		task.ID = parts[2]
+	}
+	task.ResourceVersion = node.ModifiedIndex
+	task.CurrentState.Host = parts[0]
+	return &task, nil
+}
+
+// listMachines returns the machines tasks may be stored on: the registered minions, along
+// with any machine that still has an entry under /registry/hosts. The latter covers machines
+// whose kubelet stopped heartbeating but whose tasks haven't been evicted yet.
+func (registry *EtcdRegistry) listMachines() ([]string, error) {
+	machines := []string{}
+	seen := map[string]bool{}
+	if registry.minionRegistry != nil {
+		minions, err := minionIDs(registry.minionRegistry)
+		if err != nil {
+			return machines, err
+		}
+		for _, minion := range minions {
+			seen[minion] = true
+			machines = append(machines, minion)
+		}
+	}
+	hosts, err := listHostMachines(registry.etcdClient)
+	if err != nil {
+		return machines, err
+	}
+	for _, host := range hosts {
+		if !seen[host] {
+			seen[host] = true
+			machines = append(machines, host)
+		}
+	}
+	return machines, nil
+}
+
+// listHostMachines returns the machines which have an entry under /registry/hosts.
+func listHostMachines(client EtcdClient) ([]string, error) {
+	machines := []string{}
+	result, err := client.Get("/registry/hosts", true, false)
+	if err != nil {
+		if isEtcdNotFound(err) {
+			return machines, nil
+		}
+		return machines, err
+	}
+	for _, node := range result.Node.Nodes {
+		machines = append(machines, strings.TrimPrefix(node.Key, "/registry/hosts/"))
+	}
+	return machines, nil
+}
+
 func (registry *EtcdRegistry) listEtcdNode(key string) ([]*etcd.Node, error) {
 	result, err := registry.etcdClient.Get(key, false, true)
 	if err != nil {
@@ -130,20 +274,51 @@ func (registry *EtcdRegistry) listTasksForMachine(machine string) ([]api.Task, e
 	tasks := []api.Task{}
 	key := "/registry/hosts/" + machine + "/tasks"
 	nodes, err := registry.listEtcdNode(key)
+	if err != nil {
+		return tasks, err
+	}
+	statusNodes, err := registry.listEtcdNode("/registry/hosts/" + machine + "/status")
+	if err != nil {
+		return tasks, err
+	}
+	statuses := map[string]string{}
+	for _, node := range statusNodes {
+		statuses[strings.TrimPrefix(node.Key, "/registry/hosts/"+machine+"/status/")] = node.Value
+	}
 	for _, node := range nodes {
 		task := api.Task{}
 		err = json.Unmarshal([]byte(node.Value), &task)
 		if err != nil {
 			return tasks, err
 		}
+		task.ResourceVersion = node.ModifiedIndex
 		task.CurrentState.Host = machine
+		mergeTaskStatus(&task, statuses[task.ID])
 		tasks = append(tasks, task)
 	}
-	return tasks, err
+	return tasks, nil
+}
+
+// mergeTaskStatus fills the current state of task from the status its kubelet reported.
+func mergeTaskStatus(task *api.Task, status string) {
+	if len(status) == 0 {
+		return
+	}
+	var reported api.TaskState
+	if err := json.Unmarshal([]byte(status), &reported); err != nil {
+		log.Printf("Couldn't parse status of task %s: %v", task.ID, err)
+		return
+	}
+	task.CurrentState.Status = reported.Status
+	task.CurrentState.ContainerStatuses = reported.ContainerStatuses
+	task.CurrentState.Ready = reported.Ready
 }
 
-func (registry *EtcdRegistry) loadManifests(machine string) ([]api.ContainerManifest, error) {
+// loadManifests returns the manifests of machine, along with the etcd index they were
+// last modified at. The index is 0 if the machine has no manifest list yet.
+func (registry *EtcdRegistry) loadManifests(machine string) ([]api.ContainerManifest, uint64, error) {
 	var manifests []api.ContainerManifest
+	var index uint64
 	response, err := registry.etcdClient.Get(makeContainerKey(machine), false, false)
 
 	if err != nil {
@@ -152,69 +327,119 @@ func (registry *EtcdRegistry) loadManifests(machine string) ([]api.ContainerMani
 			manifests = []api.ContainerManifest{}
 		}
 	} else {
+		index = response.Node.ModifiedIndex
 		err = json.Unmarshal([]byte(response.Node.Value), &manifests)
 	}
-	return manifests, err
+	return manifests, index, err
 }
 
-func (registry *EtcdRegistry) updateManifests(machine string, manifests []api.ContainerManifest) error {
-	containerData, err := json.Marshal(manifests)
-	if err != nil {
-		return err
+// How many times updateManifests tries to write a manifest list which keeps being changed
+// concurrently, and how long it waits after the first conflict. The wait doubles every time.
+const (
+	maxManifestUpdateAttempts = 5
+	manifestUpdateBackoff     = 10 * time.Millisecond
+)
+
+// updateManifests does a read-modify-write of the manifest list of machine. If another
+// writer changes the list in between, the list is re-read and update is applied again,
+// up to maxManifestUpdateAttempts times.
+func (registry *EtcdRegistry) updateManifests(machine string, update func([]api.ContainerManifest) ([]api.ContainerManifest, error)) error {
+	backoff := manifestUpdateBackoff
+	for attempt := 1; ; attempt++ {
+		manifests, index, err := registry.loadManifests(machine)
+		if err != nil {
+			return err
+		}
+		manifests, err = update(manifests)
+		if err != nil {
+			return err
+		}
+		containerData, err := json.Marshal(manifests)
+		if err != nil {
+			return err
+		}
+		key := makeContainerKey(machine)
+		if index == 0 {
+			_, err = registry.etcdClient.Create(key, string(containerData), 0)
+		} else {
+			_, err = registry.etcdClient.CompareAndSwap(key, string(containerData), 0, "", index)
+		}
+		if !isEtcdNodeExist(err) && !isEtcdTestFailed(err) {
+			return err
+		}
+		if attempt == maxManifestUpdateAttempts {
+			return api.NewConflict("manifests", machine, fmt.Errorf("changed concurrently %d times in a row", attempt))
+		}
+		log.Printf("Manifests of %s changed concurrently, retrying in %v", machine, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
-	_, err = registry.etcdClient.Set(makeContainerKey(machine), string(containerData), 0)
-	return err
 }
 
-func (registry *EtcdRegistry) runTask(task api.Task, machine string) error {
-	manifests, err := registry.loadManifests(machine)
-	if err != nil {
-		return err
-	}
+// clearCurrentState drops everything but the host from the current state of task before it is
+// stored. The rest is reported by the kubelet and merged in when the task is read, so a task
+// sent back by a client would only store a stale copy of it.
+func clearCurrentState(task *api.Task) {
+	task.CurrentState = api.TaskState{Host: task.CurrentState.Host}
+}
 
+func (registry *EtcdRegistry) runTask(task api.Task, machine string) error {
 	key := makeTaskKey(machine, task.ID)
+	task.ResourceVersion = 0
+	clearCurrentState(&task)
 	data, err := json.Marshal(task)
 	if err != nil {
 		return err
 	}
 	_, err = registry.etcdClient.Create(key, string(data), 0)
 	if err != nil {
-		return nil
+		if isEtcdNodeExist(err) {
+			return api.NewAlreadyExists("task", task.ID)
+		}
+		return err
 	}
 
 	manifest, err := registry.manifestFactory.MakeManifest(machine, task)
 	if err != nil {
 		return err
 	}
-	manifests = append(manifests, manifest)
-	return registry.updateManifests(machine, manifests)
+	return registry.updateManifests(machine, func(manifests []api.ContainerManifest) ([]api.ContainerManifest, error) {
+		return append(manifests, manifest), nil
+	})
 }
 
 func (registry *EtcdRegistry) deleteTaskFromMachine(machine, taskID string) error {
-	manifests, err := registry.loadManifests(machine)
-	if err != nil {
-		return err
-	}
-	newManifests := make([]api.ContainerManifest, 0)
-	found := false
-	for _, manifest := range manifests {
-		if manifest.Id != taskID {
-			newManifests = append(newManifests, manifest)
-		} else {
-			found = true
+	err := registry.updateManifests(machine, func(manifests []api.ContainerManifest) ([]api.ContainerManifest, error) {
+		newManifests := make([]api.ContainerManifest, 0)
+		found := false
+		for _, manifest := range manifests {
+			if manifest.Id != taskID {
+				newManifests = append(newManifests, manifest)
+			} else {
+				found = true
+			}
 		}
-	}
-	if !found {
-		// This really shouldn't happen, it indicates something is broken, and likely
-		// there is a lost task somewhere.
-		// However it is "deleted" so log it and move on
-		log.Printf("Couldn't find: %s in %#v", taskID, manifests)
-	}
-	if err = registry.updateManifests(machine, newManifests); err != nil {
+		if !found {
+			// This really shouldn't happen, it indicates something is broken, and likely
+			// there is a lost task somewhere.
+			// However it is "deleted" so log it and move on
+			log.Printf("Couldn't find: %s in %#v", taskID, manifests)
+		}
+		return newManifests, nil
+	})
+	if err != nil {
 		return err
 	}
 	key := makeTaskKey(machine, taskID)
 	_, err = registry.etcdClient.Delete(key, true)
+	if err != nil {
+		return err
+	}
+	_, err = registry.etcdClient.Delete(MakeTaskStatusKey(machine, taskID), false)
+	if isEtcdNotFound(err) {
+		// The kubelet hasn't reported on this task yet.
+		return nil
+	}
 	return err
 }
 
@@ -223,7 +448,7 @@ func (registry *EtcdRegistry) getTaskForMachine(machine, taskID string) (api.Tas
 	result, err := registry.etcdClient.Get(key, false, false)
 	if err != nil {
 		if isEtcdNotFound(err) {
-			return api.Task{}, fmt.Errorf("not found (%#v)", err)
+			return api.Task{}, api.NewNotFound("task", taskID)
 		} else {
 			return api.Task{}, err
 		}
@@ -233,21 +458,48 @@ func (registry *EtcdRegistry) getTaskForMachine(machine, taskID string) (api.Tas
 	}
 	task := api.Task{}
 	err = json.Unmarshal([]byte(result.Node.Value), &task)
+	if err != nil {
+		return task, err
+	}
+	task.ResourceVersion = result.Node.ModifiedIndex
 	task.CurrentState.Host = machine
-	return task, err
+	status, err := registry.etcdClient.Get(MakeTaskStatusKey(machine, taskID), false, false)
+	if err != nil && !isEtcdNotFound(err) {
+		return task, err
+	}
+	if err == nil && status.Node != nil {
+		mergeTaskStatus(&task, status.Node.Value)
+	}
+	return task, nil
 }
 
 func (registry *EtcdRegistry) findTask(taskID string) (api.Task, string, error) {
-	for _, machine := range registry.machines {
+	machines, err := registry.listMachines()
+	if err != nil {
+		return api.Task{}, "", err
+	}
+	for _, machine := range machines {
 		task, err := registry.getTaskForMachine(machine, taskID)
 		if err == nil {
 			return task, machine, nil
 		}
 	}
-	return api.Task{}, "", fmt.Errorf("task not found %s", taskID)
+	return api.Task{}, "", api.NewNotFound("task", taskID)
 }
 
 func isEtcdNotFound(err error) bool {
+	return isEtcdErrorNum(err, 100)
+}
+
+func isEtcdNodeExist(err error) bool {
+	return isEtcdErrorNum(err, 105)
+}
+
+func isEtcdTestFailed(err error) bool {
+	return isEtcdErrorNum(err, 101)
+}
+
+func isEtcdErrorNum(err error, errorCode int) bool {
 	if err == nil {
 		return false
 	}
@@ -257,7 +509,7 @@ func isEtcdNotFound(err error) bool {
 		if etcdError == nil {
 			return false
 		}
-		if etcdError.ErrorCode == 100 {
+		if etcdError.ErrorCode == errorCode {
 			return true
 		}
 	}
@@ -277,18 +529,46 @@ func (registry *EtcdRegistry) ListControllers() ([]api.ReplicationController, er
 		if err != nil {
 			return controllers, err
 		}
+		controller.ResourceVersion = node.ModifiedIndex
 		controllers = append(controllers, controller)
 	}
 	return controllers, nil
 }
 
+// WatchControllers starts a watch on replication controllers, sending only the
+// controllers whose labels match query. Query may be nil in which case all controllers are sent.
+func (registry *EtcdRegistry) WatchControllers(query *map[string]string) (watch.Interface, error) {
+	filter := func(obj interface{}) bool {
+		return labelsMatchQuery(obj.(*api.ReplicationController).Labels, query)
+	}
+	return watchEtcd(registry.etcdClient, "/registry/controllers", decodeControllerNode, filter), nil
+}
+
+func decodeControllerNode(node *etcd.Node) (interface{}, error) {
+	id := strings.TrimPrefix(node.Key, "/registry/controllers/")
+	if len(id) == 0 || strings.Contains(id, "/") {
+		return nil, nil
+	}
+	controller := api.ReplicationController{}
+	if len(node.Value) > 0 {
+		if err := json.Unmarshal([]byte(node.Value), &controller); err != nil {
+			return nil, err
+		}
+	}
+	if len(controller.ID) == 0 {
+		controller.ID = id
+	}
+	controller.ResourceVersion = node.ModifiedIndex
+	return &controller, nil
+}
+
 func (registry *EtcdRegistry) GetController(controllerID string) (*api.ReplicationController, error) {
 	var controller api.ReplicationController
 	key := makeControllerKey(controllerID)
 	result, err := registry.etcdClient.Get(key, false, false)
 	if err != nil {
 		if isEtcdNotFound(err) {
-			return nil, fmt.Errorf("controller %s not found", controllerID)
+			return nil, api.NewNotFound("replicationController", controllerID)
 		} else {
 			return nil, err
 		}
@@ -297,26 +577,175 @@ func (registry *EtcdRegistry) GetController(controllerID string) (*api.Replicati
 		return nil, fmt.Errorf("no nodes field: %#v", result)
 	}
 	err = json.Unmarshal([]byte(result.Node.Value), &controller)
+	controller.ResourceVersion = result.Node.ModifiedIndex
 	return &controller, err
 }
 
 func (registry *EtcdRegistry) CreateController(controller api.ReplicationController) error {
-	// TODO : check for existence here and error.
-	return registry.UpdateController(controller)
+	controller.ResourceVersion = 0
+	controllerData, err := json.Marshal(controller)
+	if err != nil {
+		return err
+	}
+	key := makeControllerKey(controller.ID)
+	_, err = registry.etcdClient.Create(key, string(controllerData), 0)
+	if isEtcdNodeExist(err) {
+		return api.NewAlreadyExists("replicationController", controller.ID)
+	}
+	return err
 }
 
+// UpdateController stores controller, which must already exist. If controller has a
+// ResourceVersion, the update only succeeds if the stored controller hasn't been modified
+// since that version.
 func (registry *EtcdRegistry) UpdateController(controller api.ReplicationController) error {
+	resourceVersion := controller.ResourceVersion
+	controller.ResourceVersion = 0
 	controllerData, err := json.Marshal(controller)
 	if err != nil {
 		return err
 	}
 	key := makeControllerKey(controller.ID)
-	_, err = registry.etcdClient.Set(key, string(controllerData), 0)
+	if resourceVersion == 0 {
+		existing, err := registry.GetController(controller.ID)
+		if err != nil {
+			return err
+		}
+		resourceVersion = existing.ResourceVersion
+	}
+	_, err = registry.etcdClient.CompareAndSwap(key, string(controllerData), 0, "", resourceVersion)
+	if isEtcdNotFound(err) {
+		return api.NewNotFound("replicationController", controller.ID)
+	}
+	if isEtcdTestFailed(err) {
+		return api.NewConflict("replicationController", controller.ID, fmt.Errorf("resourceVersion %d is out of date", resourceVersion))
+	}
 	return err
 }
 
 func (registry *EtcdRegistry) DeleteController(controllerID string) error {
 	key := makeControllerKey(controllerID)
 	_, err := registry.etcdClient.Delete(key, false)
+	if isEtcdNotFound(err) {
+		return api.NewNotFound("replicationController", controllerID)
+	}
+	return err
+}
+
+func (registry *EtcdRegistry) ListServices() (api.ServiceList, error) {
+	services := []api.Service{}
+	nodes, err := registry.listEtcdNode("/registry/services/specs")
+	if err != nil {
+		return api.ServiceList{Items: services}, err
+	}
+	for _, node := range nodes {
+		var service api.Service
+		err = json.Unmarshal([]byte(node.Value), &service)
+		if err != nil {
+			return api.ServiceList{Items: services}, err
+		}
+		service.ResourceVersion = node.ModifiedIndex
+		services = append(services, service)
+	}
+	return api.ServiceList{Items: services}, nil
+}
+
+func (registry *EtcdRegistry) GetService(name string) (*api.Service, error) {
+	var service api.Service
+	result, err := registry.etcdClient.Get(makeServiceKey(name), false, false)
+	if err != nil {
+		if isEtcdNotFound(err) {
+			return nil, api.NewNotFound("service", name)
+		} else {
+			return nil, err
+		}
+	}
+	if result.Node == nil || len(result.Node.Value) == 0 {
+		return nil, fmt.Errorf("no nodes field: %#v", result)
+	}
+	err = json.Unmarshal([]byte(result.Node.Value), &service)
+	service.ResourceVersion = result.Node.ModifiedIndex
+	return &service, err
+}
+
+func (registry *EtcdRegistry) CreateService(service api.Service) error {
+	service.ResourceVersion = 0
+	serviceData, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	_, err = registry.etcdClient.Create(makeServiceKey(service.ID), string(serviceData), 0)
+	if isEtcdNodeExist(err) {
+		return api.NewAlreadyExists("service", service.ID)
+	}
+	return err
+}
+
+// UpdateService stores service, which must already exist. If service has a ResourceVersion,
+// the update only succeeds if the stored service hasn't been modified since that version.
+func (registry *EtcdRegistry) UpdateService(service api.Service) error {
+	resourceVersion := service.ResourceVersion
+	service.ResourceVersion = 0
+	serviceData, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	key := makeServiceKey(service.ID)
+	if resourceVersion == 0 {
+		existing, err := registry.GetService(service.ID)
+		if err != nil {
+			return err
+		}
+		resourceVersion = existing.ResourceVersion
+	}
+	_, err = registry.etcdClient.CompareAndSwap(key, string(serviceData), 0, "", resourceVersion)
+	if isEtcdNotFound(err) {
+		return api.NewNotFound("service", service.ID)
+	}
+	if isEtcdTestFailed(err) {
+		return api.NewConflict("service", service.ID, fmt.Errorf("resourceVersion %d is out of date", resourceVersion))
+	}
+	return err
+}
+
+func (registry *EtcdRegistry) DeleteService(name string) error {
+	_, err := registry.etcdClient.Delete(makeServiceKey(name), false)
+	if isEtcdNotFound(err) {
+		return api.NewNotFound("service", name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = registry.etcdClient.Delete(makeEndpointsKey(name), false)
+	if isEtcdNotFound(err) {
+		// The endpoints controller hasn't seen this service yet.
+		return nil
+	}
+	return err
+}
+
+func (registry *EtcdRegistry) GetEndpoints(name string) (*api.Endpoints, error) {
+	var endpoints api.Endpoints
+	result, err := registry.etcdClient.Get(makeEndpointsKey(name), false, false)
+	if err != nil {
+		if isEtcdNotFound(err) {
+			return nil, api.NewNotFound("endpoints", name)
+		} else {
+			return nil, err
+		}
+	}
+	if result.Node == nil || len(result.Node.Value) == 0 {
+		return nil, fmt.Errorf("no nodes field: %#v", result)
+	}
+	err = json.Unmarshal([]byte(result.Node.Value), &endpoints)
+	return &endpoints, err
+}
+
+func (registry *EtcdRegistry) UpdateEndpoints(endpoints api.Endpoints) error {
+	data, err := json.Marshal(endpoints)
+	if err != nil {
+		return err
+	}
+	_, err = registry.etcdClient.Set(makeEndpointsKey(endpoints.Name), string(data), 0)
 	return err
 }
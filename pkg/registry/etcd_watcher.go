@@ -0,0 +1,139 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package registry
+
+import (
+	"log"
+	"sync"
+
+	"github.com/kawabatas/toy-k8s/pkg/util"
+	"github.com/kawabatas/toy-k8s/pkg/watch"
+	"github.com/kawabatas/toy-k8s/third_party/github.com/coreos/go-etcd/etcd"
+)
+
+// etcdDecodeFunc turns an etcd node into an api object. It returns a nil object for
+// nodes which aren't of interest to the watch (e.g. other keys under the same prefix).
+type etcdDecodeFunc func(node *etcd.Node) (interface{}, error)
+
+// etcdFilterFunc returns true if an object should be sent to the watcher.
+type etcdFilterFunc func(obj interface{}) bool
+
+// etcdWatcher converts a recursive etcd watch on a prefix into a watch.Interface.
+type etcdWatcher struct {
+	decode etcdDecodeFunc
+	filter etcdFilterFunc
+
+	etcdIncoming chan *etcd.Response
+	etcdStop     chan bool
+
+	outgoing chan watch.Event
+	userStop chan bool
+	stopLock sync.Mutex
+	stopped  bool
+}
+
+// watchEtcd starts watching 'key' and everything below it, from the next change on.
+func watchEtcd(client EtcdClient, key string, decode etcdDecodeFunc, filter etcdFilterFunc) *etcdWatcher {
+	w := &etcdWatcher{
+		decode:       decode,
+		filter:       filter,
+		etcdIncoming: make(chan *etcd.Response),
+		etcdStop:     make(chan bool),
+		outgoing:     make(chan watch.Event),
+		userStop:     make(chan bool),
+	}
+	go w.etcdWatch(client, key)
+	go w.translate()
+	return w
+}
+
+// etcdWatch runs the etcd watch. The etcd client closes etcdIncoming when it returns.
+func (w *etcdWatcher) etcdWatch(client EtcdClient, key string) {
+	defer util.HandleCrash()
+	_, err := client.Watch(key, 0, true, w.etcdIncoming, w.etcdStop)
+	if err != nil && err != etcd.ErrWatchStoppedByUser {
+		log.Printf("etcd watch on %s ended: %v", key, err)
+	}
+}
+
+// translate pulls responses from etcd and sends them on as events, until etcd
+// closes etcdIncoming. It keeps draining etcdIncoming after Stop() so the etcd
+// client is never left blocked on a send.
+func (w *etcdWatcher) translate() {
+	defer close(w.outgoing)
+	defer util.HandleCrash()
+	for response := range w.etcdIncoming {
+		event, ok := w.makeEvent(response)
+		if !ok {
+			continue
+		}
+		select {
+		case w.outgoing <- event:
+		case <-w.userStop:
+		}
+	}
+}
+
+func (w *etcdWatcher) makeEvent(response *etcd.Response) (watch.Event, bool) {
+	var node *etcd.Node
+	var eventType watch.EventType
+	switch response.Action {
+	case "create":
+		node, eventType = response.Node, watch.Added
+	case "set", "update", "compareAndSwap":
+		node, eventType = response.Node, watch.Modified
+		if response.PrevNode == nil {
+			eventType = watch.Added
+		}
+	case "delete", "expire", "compareAndDelete":
+		node, eventType = response.PrevNode, watch.Deleted
+		if node == nil && response.Node != nil {
+			// Older etcd servers don't send the previous value, report what we know.
+			node = &etcd.Node{Key: response.Node.Key}
+		}
+	default:
+		log.Printf("Unknown etcd action: %s", response.Action)
+		return watch.Event{}, false
+	}
+	if node == nil || node.Dir {
+		return watch.Event{}, false
+	}
+	obj, err := w.decode(node)
+	if err != nil {
+		log.Printf("Failure to decode etcd node %s: %v", node.Key, err)
+		return watch.Event{}, false
+	}
+	if obj == nil || (w.filter != nil && !w.filter(obj)) {
+		return watch.Event{}, false
+	}
+	return watch.Event{Type: eventType, Object: obj}, true
+}
+
+// ResultChan implements watch.Interface.
+func (w *etcdWatcher) ResultChan() <-chan watch.Event {
+	return w.outgoing
+}
+
+// Stop implements watch.Interface.
+func (w *etcdWatcher) Stop() {
+	w.stopLock.Lock()
+	defer w.stopLock.Unlock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.etcdStop)
+		close(w.userStop)
+	}
+}
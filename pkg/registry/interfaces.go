@@ -17,6 +17,7 @@ package registry
 
 import (
 	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/watch"
 )
 
 // TaskRegistry is an interface implemented by things that know how to store Task objects
@@ -32,6 +33,9 @@ type TaskRegistry interface {
 	UpdateTask(task api.Task) error
 	// Delete an existing task
 	DeleteTask(taskId string) error
+	// WatchTasks reports changes to the tasks that match query.
+	// Query may be nil in which case changes to all tasks are reported.
+	WatchTasks(query *map[string]string) (watch.Interface, error)
 }
 
 // ControllerRegistry is an interface for things that know how to store Controllers
@@ -41,4 +45,22 @@ type ControllerRegistry interface {
 	CreateController(controller api.ReplicationController) error
 	UpdateController(controller api.ReplicationController) error
 	DeleteController(controllerId string) error
+	WatchControllers(query *map[string]string) (watch.Interface, error)
+}
+
+// ServiceRegistry is an interface for things that know how to store Services
+type ServiceRegistry interface {
+	ListServices() (api.ServiceList, error)
+	GetService(name string) (*api.Service, error)
+	CreateService(service api.Service) error
+	UpdateService(service api.Service) error
+	DeleteService(name string) error
+	GetEndpoints(name string) (*api.Endpoints, error)
+	UpdateEndpoints(endpoints api.Endpoints) error
+}
+
+// MinionRegistry is an interface for things that know which machines are available to run tasks on.
+type MinionRegistry interface {
+	List() ([]api.Minion, error)
+	Get(minionID string) (*api.Minion, error)
 }
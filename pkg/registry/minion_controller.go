@@ -0,0 +1,149 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/client"
+)
+
+// MinionController tracks the health of machines through the heartbeats of their kubelets.
+// A machine whose last heartbeat is older than gracePeriod is marked NotReady, so that no new
+// tasks are scheduled onto it. Once its last heartbeat is older than evictionTimeout, its
+// tasks are deleted, so that replication controllers recreate them elsewhere.
+type MinionController struct {
+	etcdClient      EtcdClient
+	minionRegistry  MinionRegistry
+	kubeClient      client.ClientInterface
+	gracePeriod     time.Duration
+	evictionTimeout time.Duration
+	// When a machine with tasks but without a minion record was first seen, keyed by machine.
+	// Such a machine never heartbeated, or its record expired after MinionTTL, so that is the
+	// closest thing to a last heartbeat.
+	missingSince map[string]time.Time
+}
+
+func MakeMinionController(etcdClient EtcdClient, kubeClient client.ClientInterface, gracePeriod, evictionTimeout time.Duration) *MinionController {
+	return &MinionController{
+		etcdClient:      etcdClient,
+		minionRegistry:  MakeEtcdMinionRegistry(etcdClient),
+		kubeClient:      kubeClient,
+		gracePeriod:     gracePeriod,
+		evictionTimeout: evictionTimeout,
+		missingSince:    map[string]time.Time{},
+	}
+}
+
+// SyncMinions checks every known machine once, marking and evicting machines as needed.
+func (mc *MinionController) SyncMinions() error {
+	minions, err := mc.minionRegistry.List()
+	if err != nil {
+		return err
+	}
+	hosts, err := listHostMachines(mc.etcdClient)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	registered := map[string]bool{}
+	for _, minion := range minions {
+		registered[minion.ID] = true
+		delete(mc.missingSince, minion.ID)
+		missing := now.Sub(time.Unix(minion.LastHeartbeat, 0))
+		if missing >= mc.evictionTimeout {
+			if err := mc.evictMachine(minion.ID); err != nil {
+				log.Printf("Error evicting %s: %v", minion.ID, err)
+			}
+			continue
+		}
+		if missing >= mc.gracePeriod && minion.Status != api.MinionNotReady {
+			log.Printf("Minion %s has missed its heartbeats for %v, marking it %s", minion.ID, missing, api.MinionNotReady)
+			if err := mc.markNotReady(minion); err != nil {
+				log.Printf("Error marking %s %s: %v", minion.ID, api.MinionNotReady, err)
+			}
+		}
+	}
+	for _, machine := range hosts {
+		if registered[machine] {
+			continue
+		}
+		since, ok := mc.missingSince[machine]
+		if !ok {
+			since = now
+			mc.missingSince[machine] = since
+		}
+		if now.Sub(since) >= mc.evictionTimeout {
+			if err := mc.evictMachine(machine); err != nil {
+				log.Printf("Error evicting %s: %v", machine, err)
+			}
+		}
+	}
+	return nil
+}
+
+// markNotReady rewrites the record of minion with the NotReady status, keeping its last
+// heartbeat and when it expires. The write is skipped if the kubelet heartbeated since
+// minion was read.
+func (mc *MinionController) markNotReady(minion api.Minion) error {
+	ttl := MinionTTL - time.Since(time.Unix(minion.LastHeartbeat, 0))
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	minion.Status = api.MinionNotReady
+	index := minion.ResourceVersion
+	minion.ResourceVersion = 0
+	data, err := json.Marshal(minion)
+	if err != nil {
+		return err
+	}
+	_, err = mc.etcdClient.CompareAndSwap(MakeMinionKey(minion.ID), string(data), uint64(ttl.Seconds()), "", index)
+	if isEtcdTestFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// evictMachine deletes all tasks of machine, and then forgets about the machine.
+func (mc *MinionController) evictMachine(machine string) error {
+	tasks, err := mc.kubeClient.ListTasks(nil)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks.Items {
+		if task.CurrentState.Host != machine {
+			continue
+		}
+		log.Printf("Evicting task %s from %s", task.ID, machine)
+		if err := mc.kubeClient.DeleteTask(task.ID); err != nil && !api.IsNotFound(err) {
+			return fmt.Errorf("couldn't delete task %s: %v", task.ID, err)
+		}
+	}
+	log.Printf("Removing minion %s", machine)
+	if _, err := mc.etcdClient.Delete("/registry/hosts/"+machine, true); err != nil && !isEtcdNotFound(err) {
+		return err
+	}
+	if _, err := mc.etcdClient.Delete(MakeMinionKey(machine), false); err != nil && !isEtcdNotFound(err) {
+		return err
+	}
+	delete(mc.missingSince, machine)
+	return nil
+}
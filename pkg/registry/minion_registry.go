@@ -0,0 +1,204 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package registry
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/apiserver"
+	"github.com/kawabatas/toy-k8s/third_party/github.com/coreos/go-etcd/etcd"
+)
+
+// MinionTTL is how long a minion record outlives the last heartbeat of its kubelet. It is
+// longer than the MinionController's eviction timeout, so that the controller decides when a
+// silent minion goes away, but records of decommissioned machines still expire without it.
+const MinionTTL = 10 * time.Minute
+
+// MakeMinionKey returns the key a kubelet registers itself under. The kubelet rewrites it
+// periodically with its latest heartbeat, with a TTL of MinionTTL.
+func MakeMinionKey(minionID string) string {
+	return "/registry/minions/" + minionID
+}
+
+// EtcdMinionRegistry lists the minions whose kubelets are currently registered in etcd.
+type EtcdMinionRegistry struct {
+	etcdClient EtcdClient
+}
+
+func MakeEtcdMinionRegistry(client EtcdClient) MinionRegistry {
+	return &EtcdMinionRegistry{
+		etcdClient: client,
+	}
+}
+
+func (registry *EtcdMinionRegistry) List() ([]api.Minion, error) {
+	minions := []api.Minion{}
+	result, err := registry.etcdClient.Get("/registry/minions", true, true)
+	if err != nil {
+		if isEtcdNotFound(err) {
+			return minions, nil
+		}
+		return minions, err
+	}
+	for _, node := range result.Node.Nodes {
+		minion, err := decodeMinion(node)
+		if err != nil {
+			return minions, err
+		}
+		minions = append(minions, minion)
+	}
+	return minions, nil
+}
+
+func (registry *EtcdMinionRegistry) Get(minionID string) (*api.Minion, error) {
+	result, err := registry.etcdClient.Get(MakeMinionKey(minionID), false, false)
+	if err != nil {
+		if isEtcdNotFound(err) {
+			return nil, api.NewNotFound("minion", minionID)
+		}
+		return nil, err
+	}
+	minion, err := decodeMinion(result.Node)
+	return &minion, err
+}
+
+func decodeMinion(node *etcd.Node) (api.Minion, error) {
+	minion := api.Minion{}
+	if len(node.Value) > 0 {
+		if err := json.Unmarshal([]byte(node.Value), &minion); err != nil {
+			return minion, err
+		}
+	}
+	minion.ID = strings.TrimPrefix(node.Key, "/registry/minions/")
+	minion.ResourceVersion = node.ModifiedIndex
+	return minion, nil
+}
+
+// StaticMinionRegistry is a fixed list of minions, such as the one given by the apiserver's
+// --machines flag.
+type StaticMinionRegistry struct {
+	minions []string
+}
+
+func MakeStaticMinionRegistry(minions []string) MinionRegistry {
+	sorted := append([]string{}, minions...)
+	sort.Strings(sorted)
+	return &StaticMinionRegistry{
+		minions: sorted,
+	}
+}
+
+func (registry *StaticMinionRegistry) List() ([]api.Minion, error) {
+	minions := []api.Minion{}
+	for _, minion := range registry.minions {
+		minions = append(minions, api.Minion{JSONBase: api.JSONBase{ID: minion}, Status: api.MinionReady})
+	}
+	return minions, nil
+}
+
+func (registry *StaticMinionRegistry) Get(minionID string) (*api.Minion, error) {
+	for _, minion := range registry.minions {
+		if minion == minionID {
+			return &api.Minion{JSONBase: api.JSONBase{ID: minion}, Status: api.MinionReady}, nil
+		}
+	}
+	return nil, api.NewNotFound("minion", minionID)
+}
+
+// minionIDs returns the IDs of the minions currently in registry.
+func minionIDs(registry MinionRegistry) ([]string, error) {
+	minions, err := registry.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, minion := range minions {
+		ids = append(ids, minion.ID)
+	}
+	return ids, nil
+}
+
+// readyMinions returns the minions in registry which can take new tasks.
+func readyMinions(registry MinionRegistry) ([]api.Minion, error) {
+	minions, err := registry.List()
+	if err != nil {
+		return nil, err
+	}
+	ready := []api.Minion{}
+	for _, minion := range minions {
+		if minion.Status != api.MinionNotReady {
+			ready = append(ready, minion)
+		}
+	}
+	return ready, nil
+}
+
+// readyMinionIDs returns the IDs of the minions in registry which can take new tasks.
+func readyMinionIDs(registry MinionRegistry) ([]string, error) {
+	minions, err := readyMinions(registry)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, minion := range minions {
+		ids = append(ids, minion.ID)
+	}
+	return ids, nil
+}
+
+// MinionRegistryStorage implements a read-only RESTStorage in terms of a MinionRegistry.
+// Minions add themselves by registering their kubelet.
+type MinionRegistryStorage struct {
+	registry MinionRegistry
+}
+
+func MakeMinionRegistryStorage(registry MinionRegistry) apiserver.RESTStorage {
+	return &MinionRegistryStorage{
+		registry: registry,
+	}
+}
+
+func (storage *MinionRegistryStorage) List(*url.URL) (interface{}, error) {
+	minions, err := storage.registry.List()
+	return api.MinionList{Items: minions}, err
+}
+
+func (storage *MinionRegistryStorage) Get(id string) (interface{}, error) {
+	return storage.registry.Get(id)
+}
+
+func (storage *MinionRegistryStorage) Delete(id string) error {
+	return api.NewMethodNotSupported("minion", "delete")
+}
+
+func (storage *MinionRegistryStorage) Extract(body string) (interface{}, error) {
+	minion := api.Minion{}
+	err := json.Unmarshal([]byte(body), &minion)
+	return minion, err
+}
+
+func (storage *MinionRegistryStorage) Create(minion interface{}) error {
+	return api.NewMethodNotSupported("minion", "create")
+}
+
+func (storage *MinionRegistryStorage) Update(minion interface{}) error {
+	return api.NewMethodNotSupported("minion", "update")
+}
@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"strings"
 	"sync"
 	"time"
 
@@ -143,7 +142,7 @@ func (rm *ReplicationManager) syncReplicationController(controllerSpec api.Repli
 func (rm *ReplicationManager) filterActiveTasks(tasks []api.Task) []api.Task {
 	var result []api.Task
 	for _, value := range tasks {
-		if !strings.Contains(value.CurrentState.Status, "Exit") {
+		if value.CurrentState.Status != api.TaskTerminated {
 			result = append(result, value)
 		}
 	}
@@ -165,12 +164,16 @@ func (rm *ReplicationManager) WatchControllers() {
 			log.Printf("Error handling data: %#v, %#v", err, watchResponse)
 			continue
 		}
+		if controller == nil {
+			continue
+		}
 		rm.syncReplicationController(*controller)
 	}
 }
 
 func (rm *ReplicationManager) handleWatchResponse(response *etcd.Response) (*api.ReplicationController, error) {
-	if response.Action == "set" {
+	switch response.Action {
+	case "set", "create", "update", "compareAndSwap":
 		if response.Node != nil {
 			var controllerSpec api.ReplicationController
 			err := json.Unmarshal([]byte(response.Node.Value), &controllerSpec)
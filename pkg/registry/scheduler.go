@@ -18,6 +18,7 @@ package registry
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 
 	"github.com/kawabatas/toy-k8s/pkg/api"
 )
@@ -29,30 +30,37 @@ type Scheduler interface {
 
 // RandomScheduler choses machines uniformly at random.
 type RandomScheduler struct {
-	machines []string
-	random   rand.Rand
+	minions MinionRegistry
+	random  rand.Rand
 }
 
-func MakeRandomScheduler(machines []string, random rand.Rand) Scheduler {
+func MakeRandomScheduler(minions MinionRegistry, random rand.Rand) Scheduler {
 	return &RandomScheduler{
-		machines: machines,
-		random:   random,
+		minions: minions,
+		random:  random,
 	}
 }
 
 func (s *RandomScheduler) Schedule(task api.Task) (string, error) {
-	return s.machines[s.random.Int()%len(s.machines)], nil
+	machines, err := readyMinionIDs(s.minions)
+	if err != nil {
+		return "", err
+	}
+	if len(machines) == 0 {
+		return "", fmt.Errorf("no minions available to schedule %s onto", task.ID)
+	}
+	return machines[s.random.Int()%len(machines)], nil
 }
 
 // RoundRobinScheduler chooses machines in order.
 type RoundRobinScheduler struct {
-	machines     []string
+	minions      MinionRegistry
 	currentIndex int
 }
 
-func MakeRoundRobinScheduler(machines []string) Scheduler {
+func MakeRoundRobinScheduler(minions MinionRegistry) Scheduler {
 	return &RoundRobinScheduler{
-		machines:     machines,
+		minions:      minions,
 		currentIndex: 0,
 	}
 }
@@ -63,13 +71,13 @@ func (s *RoundRobinScheduler) Schedule(task api.Task) (string, error) {
 }
 
 type FirstFitScheduler struct {
-	machines []string
+	minions  MinionRegistry
 	registry TaskRegistry
 }
 
-func MakeFirstFitScheduler(machines []string, registry TaskRegistry) Scheduler {
+func MakeFirstFitScheduler(minions MinionRegistry, registry TaskRegistry) Scheduler {
 	return &FirstFitScheduler{
-		machines: machines,
+		minions:  minions,
 		registry: registry,
 	}
 }
@@ -84,8 +92,13 @@ func (s *FirstFitScheduler) Schedule(task api.Task) (string, error) {
 		host := scheduledTask.CurrentState.Host
 		machineToTasks[host] = append(machineToTasks[host], scheduledTask)
 	}
-	for _, machine := range s.machines {
-		taskFits := true
+	minions, err := readyMinions(s.minions)
+	if err != nil {
+		return "", err
+	}
+	for _, minion := range minions {
+		machine := minion.ID
+		taskFits := s.fitsResources(minion, machineToTasks[machine], task)
 		for _, scheduledTask := range machineToTasks[machine] {
 			for _, container := range task.DesiredState.Manifest.Containers {
 				for _, port := range container.Ports {
@@ -102,13 +115,63 @@ func (s *FirstFitScheduler) Schedule(task api.Task) (string, error) {
 	return "", fmt.Errorf("failed to find fit for %#v", task)
 }
 
+// Does task fit in the memory and CPU of minion left over by the tasks already on it?
+// Resources with an unknown capacity always fit.
+func (s *FirstFitScheduler) fitsResources(minion api.Minion, scheduled []api.Task, task api.Task) bool {
+	memory, cpu := taskResources(task)
+	for _, scheduledTask := range scheduled {
+		scheduledMemory, scheduledCPU := taskResources(scheduledTask)
+		memory += scheduledMemory
+		cpu += scheduledCPU
+	}
+	if minion.MemoryCapacity > 0 && memory > minion.MemoryCapacity {
+		return false
+	}
+	if minion.CPUCapacity > 0 && cpu > minion.CPUCapacity {
+		return false
+	}
+	return true
+}
+
+// Returns the total memory and CPU declared by the containers of task.
+func taskResources(task api.Task) (memory, cpu int) {
+	for _, container := range task.DesiredState.Manifest.Containers {
+		memory += container.Memory
+		cpu += container.CPU
+	}
+	return memory, cpu
+}
+
+// Does task publish a host port which conflicts with port? Ports conflict when they have the
+// same number and protocol, on overlapping host addresses. Unpublished ports never conflict.
 func (s *FirstFitScheduler) containsPort(task api.Task, port api.Port) bool {
+	if port.HostPort == 0 {
+		return false
+	}
 	for _, container := range task.DesiredState.Manifest.Containers {
 		for _, taskPort := range container.Ports {
-			if taskPort.HostPort == port.HostPort {
+			if taskPort.HostPort == port.HostPort &&
+				portProtocol(taskPort) == portProtocol(port) &&
+				hostIPsOverlap(taskPort.HostIP, port.HostIP) {
 				return true
 			}
 		}
 	}
 	return false
 }
+
+// Returns the protocol of port, defaulting to TCP.
+func portProtocol(port api.Port) string {
+	if len(port.Protocol) == 0 {
+		return api.ProtocolTCP
+	}
+	return strings.ToUpper(port.Protocol)
+}
+
+// Can ports bound on host addresses a and b collide? An empty address binds all addresses.
+func hostIPsOverlap(a, b string) bool {
+	isAny := func(ip string) bool {
+		return len(ip) == 0 || ip == "0.0.0.0" || ip == "::"
+	}
+	return isAny(a) || isAny(b) || a == b
+}
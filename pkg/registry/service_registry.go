@@ -0,0 +1,81 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package registry
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/kawabatas/toy-k8s/pkg/api"
+	"github.com/kawabatas/toy-k8s/pkg/apiserver"
+)
+
+// ServiceRegistryStorage implements the RESTStorage interface in terms of a ServiceRegistry
+type ServiceRegistryStorage struct {
+	registry ServiceRegistry
+}
+
+func MakeServiceRegistryStorage(registry ServiceRegistry) apiserver.RESTStorage {
+	return &ServiceRegistryStorage{
+		registry: registry,
+	}
+}
+
+func (storage *ServiceRegistryStorage) List(url *url.URL) (interface{}, error) {
+	list, err := storage.registry.ListServices()
+	if err != nil {
+		return list, err
+	}
+	query := labelQueryFromURL(url)
+	services := []api.Service{}
+	for _, service := range list.Items {
+		if labelsMatchQuery(service.Labels, query) {
+			services = append(services, service)
+		}
+	}
+	list.Items = services
+	return list, nil
+}
+
+func (storage *ServiceRegistryStorage) Get(id string) (interface{}, error) {
+	return storage.registry.GetService(id)
+}
+
+func (storage *ServiceRegistryStorage) Delete(id string) error {
+	return storage.registry.DeleteService(id)
+}
+
+func (storage *ServiceRegistryStorage) Extract(body string) (interface{}, error) {
+	service := api.Service{}
+	err := json.Unmarshal([]byte(body), &service)
+	return service, err
+}
+
+func (storage *ServiceRegistryStorage) Create(service interface{}) error {
+	serviceObj := service.(api.Service)
+	if len(serviceObj.ID) == 0 {
+		return api.NewInvalid("service", serviceObj.ID, "id is unspecified")
+	}
+	return storage.registry.CreateService(serviceObj)
+}
+
+func (storage *ServiceRegistryStorage) Update(service interface{}) error {
+	serviceObj := service.(api.Service)
+	if len(serviceObj.ID) == 0 {
+		return api.NewInvalid("service", serviceObj.ID, "id is unspecified")
+	}
+	return storage.registry.UpdateService(serviceObj)
+}
@@ -18,11 +18,13 @@ package registry
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/url"
 
 	"github.com/kawabatas/toy-k8s/pkg/api"
 	"github.com/kawabatas/toy-k8s/pkg/apiserver"
 	"github.com/kawabatas/toy-k8s/pkg/client"
+	"github.com/kawabatas/toy-k8s/pkg/watch"
 )
 
 // TaskRegistryStorage implements the RESTStorage interface in terms of a TaskRegistry
@@ -52,25 +54,34 @@ func LabelMatch(task api.Task, queryKey, queryValue string) bool {
 
 // LabelMatch tests to see if a Task's labels map contains all key/value pairs in 'labelQuery'
 func LabelsMatch(task api.Task, labelQuery *map[string]string) bool {
+	return labelsMatchQuery(task.Labels, labelQuery)
+}
+
+// labelsMatchQuery tests to see if 'labels' contains all key/value pairs in 'labelQuery'
+func labelsMatchQuery(labels map[string]string, labelQuery *map[string]string) bool {
 	if labelQuery == nil {
 		return true
 	}
 	for key, value := range *labelQuery {
-		if !LabelMatch(task, key, value) {
+		if labelValue, ok := labels[key]; !ok || labelValue != value {
 			return false
 		}
 	}
 	return true
 }
 
+// labelQueryFromURL decodes the 'labels' parameter of a request, or returns nil if there is no request.
+func labelQueryFromURL(url *url.URL) *map[string]string {
+	if url == nil {
+		return nil
+	}
+	query := client.DecodeLabelQuery(url.Query().Get("labels"))
+	return &query
+}
+
 func (storage *TaskRegistryStorage) List(url *url.URL) (interface{}, error) {
 	var result api.TaskList
-	var query *map[string]string
-	if url != nil {
-		queryMap := client.DecodeLabelQuery(url.Query().Get("labels"))
-		query = &queryMap
-	}
-	tasks, err := storage.registry.ListTasks(query)
+	tasks, err := storage.registry.ListTasks(labelQueryFromURL(url))
 	if err == nil {
 		result = api.TaskList{
 			Items: tasks,
@@ -86,10 +97,12 @@ func (storage *TaskRegistryStorage) Get(id string) (interface{}, error) {
 	}
 	info, err := storage.containerInfo.GetContainerInfo(task.CurrentState.Host, id)
 	if err != nil {
-		return task, err
+		// The task is still worth returning if its kubelet can't be reached.
+		log.Printf("Error getting container info of %s from %s: %v", id, task.CurrentState.Host, err)
+		return task, nil
 	}
 	task.CurrentState.Info = info
-	return task, err
+	return task, nil
 }
 
 func (storage *TaskRegistryStorage) Delete(id string) error {
@@ -105,7 +118,10 @@ func (storage *TaskRegistryStorage) Extract(body string) (interface{}, error) {
 func (storage *TaskRegistryStorage) Create(task interface{}) error {
 	taskObj := task.(api.Task)
 	if len(taskObj.ID) == 0 {
-		return fmt.Errorf("ID is unspecified: %#v", task)
+		return api.NewInvalid("task", taskObj.ID, "id is unspecified")
+	}
+	if err := validatePorts(&taskObj.DesiredState.Manifest); err != nil {
+		return api.NewInvalid("task", taskObj.ID, err.Error())
 	}
 	machine, err := storage.scheduler.Schedule(taskObj)
 	if err != nil {
@@ -115,5 +131,30 @@ func (storage *TaskRegistryStorage) Create(task interface{}) error {
 }
 
 func (storage *TaskRegistryStorage) Update(task interface{}) error {
-	return storage.registry.UpdateTask(task.(api.Task))
+	taskObj := task.(api.Task)
+	if len(taskObj.ID) == 0 {
+		return api.NewInvalid("task", taskObj.ID, "id is unspecified")
+	}
+	if err := validatePorts(&taskObj.DesiredState.Manifest); err != nil {
+		return api.NewInvalid("task", taskObj.ID, err.Error())
+	}
+	return storage.registry.UpdateTask(taskObj)
+}
+
+// validatePorts checks that the kubelet can bind the ports of manifest.
+func validatePorts(manifest *api.ContainerManifest) error {
+	for _, container := range manifest.Containers {
+		for _, port := range container.Ports {
+			switch portProtocol(port) {
+			case api.ProtocolTCP, api.ProtocolUDP:
+			default:
+				return fmt.Errorf("port %d of container %s has unsupported protocol %q", port.ContainerPort, container.Name, port.Protocol)
+			}
+		}
+	}
+	return nil
+}
+
+func (storage *TaskRegistryStorage) Watch(url *url.URL) (watch.Interface, error) {
+	return storage.registry.WatchTasks(labelQueryFromURL(url))
 }
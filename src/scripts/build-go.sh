@@ -18,7 +18,7 @@
 
 set -e
 
-BINARIES="apiserver controller-manager kubelet cloudcfg"
+BINARIES="apiserver controller-manager kubelet proxy cloudcfg"
 
 for b in $BINARIES; do
   echo "+++ Building ${b}"
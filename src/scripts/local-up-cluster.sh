@@ -45,8 +45,7 @@ KUBELET_PORT=10250
 $(dirname $0)/../../bin/apiserver \
   --address="127.0.0.1" \
   --port="${API_PORT}" \
-  --etcd_servers="http://127.0.0.1:4001" \
-  --machines="127.0.0.1" &> /tmp/apiserver.log &
+  --etcd_servers="http://127.0.0.1:4001" &> /tmp/apiserver.log &
 APISERVER_PID=$!
 
 $(dirname $0)/../../bin/controller-manager \
@@ -61,10 +60,15 @@ $(dirname $0)/../../bin/kubelet \
   --port="$KUBELET_PORT" &> /tmp/kubelet.log &
 KUBELET_PID=$!
 
+$(dirname $0)/../../bin/proxy \
+  --etcd_servers="http://127.0.0.1:4001" &> /tmp/proxy.log &
+PROXY_PID=$!
+
 echo "Local Kubernetes cluster is running. Press enter to shut it down."
 read unused
 
 kill ${APISERVER_PID}
 kill ${CTLRMGR_PID}
 kill ${KUBELET_PID}
+kill ${PROXY_PID}
 kill ${ETCD_PID}